@@ -0,0 +1,419 @@
+// Package book builds EPUB publications from declarative book descriptions in
+// YAML, JSON or TOML format: the publication metadata, the cover, the content
+// files in the spine order and other resources.
+//
+// Example of the description in YAML format:
+//
+//	title: The Book
+//	lang: en
+//	authors:
+//	  - name: John Smith
+//	    file-as: Smith, John
+//	  - {name: Jane Doe, role: ill}
+//	identifiers:
+//	  - {value: "9780000000000", scheme: isbn}
+//	series: {name: The Series, position: 2}
+//	subjects: [Fiction]
+//	cover: images/cover.jpg
+//	stylesheet: css/style.css
+//	files:
+//	  - chapter01.md
+//	  - {path: notes.xhtml, title: Notes, linear: false}
+//	resources: [images/*.png]
+package book
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	epub "github.com/mdigger/epub3"
+	"github.com/mdigger/epub3/markdown"
+	"gopkg.in/yaml.v3"
+)
+
+// Book is the declarative description of the publication.
+type Book struct {
+	Title        string       `json:"title"`                  // Publication title.
+	Subtitle     string       `json:"subtitle,omitempty"`     // Publication subtitle.
+	Lang         string       `json:"lang,omitempty"`         // Publication language (BCP 47).
+	Authors      []Author     `json:"authors,omitempty"`      // Authors (dc:creator).
+	Contributors []Author     `json:"contributors,omitempty"` // Contributors, such as editors or translators (dc:contributor).
+	Identifiers  []Identifier `json:"identifiers,omitempty"`  // Publication identifiers; the first one is the unique identifier.
+	Series       *Series      `json:"series,omitempty"`       // Series the publication belongs to.
+	Subjects     []string     `json:"subjects,omitempty"`     // Publication subjects.
+	Description  string       `json:"description,omitempty"`  // Publication description.
+	Publisher    string       `json:"publisher,omitempty"`    // Publication publisher.
+	Rights       string       `json:"rights,omitempty"`       // Publication rights.
+	Date         string       `json:"date,omitempty"`         // Publication date: CCYY, CCYY-MM or CCYY-MM-DD.
+	Cover        string       `json:"cover,omitempty"`        // Name of the cover image file.
+	Stylesheet   string       `json:"stylesheet,omitempty"`   // Name of the style sheet linked from the chapters generated from Markdown files.
+	Files        []File       `json:"files"`                  // Content files in the spine order.
+	Resources    []string     `json:"resources,omitempty"`    // Patterns of the resource file names, such as “images/*.png”.
+}
+
+// Author describes the creator or the contributor of the publication. It can
+// be defined as the name only.
+type Author struct {
+	Name   string `json:"name"`              // Name of the person or organization.
+	FileAs string `json:"file-as,omitempty"` // Normalized form of the name used for sorting, such as “Smith, John”.
+	Role   string `json:"role,omitempty"`    // MARC relator code of the role, such as “aut”, “edt”, “ill” or “trl”.
+}
+
+// UnmarshalJSON implements json.Unmarshaler interface.
+func (a *Author) UnmarshalJSON(data []byte) error {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte(`"`)) {
+		return json.Unmarshal(data, &a.Name)
+	}
+	type author Author // avoid recursion
+	return json.Unmarshal(data, (*author)(a))
+}
+
+// Identifier describes the publication identifier.
+type Identifier struct {
+	Value  string `json:"value"`            // Identifier value.
+	Scheme string `json:"scheme,omitempty"` // Identifier scheme, such as “isbn”, “uuid” or “doi”.
+}
+
+// UnmarshalJSON implements json.Unmarshaler interface.
+func (i *Identifier) UnmarshalJSON(data []byte) error {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte(`"`)) {
+		return json.Unmarshal(data, &i.Value)
+	}
+	type identifier Identifier // avoid recursion
+	return json.Unmarshal(data, (*identifier)(i))
+}
+
+// Series describes the series the publication belongs to.
+type Series struct {
+	Name     string  `json:"name"`               // Name of the series.
+	Position float64 `json:"position,omitempty"` // Position of the publication in the series.
+}
+
+// UnmarshalJSON implements json.Unmarshaler interface. The position can be
+// defined as the number or the string.
+func (s *Series) UnmarshalJSON(data []byte) error {
+	var series struct {
+		Name     string      `json:"name"`
+		Position json.Number `json:"position"`
+	}
+	if err := json.Unmarshal(data, &series); err != nil {
+		return err
+	}
+	s.Name, s.Position = series.Name, 0
+	if series.Position != "" {
+		position, err := series.Position.Float64()
+		if err != nil {
+			return err
+		}
+		s.Position = position
+	}
+	return nil
+}
+
+// File describes the content file of the publication. It can be defined as
+// the file name only. Markdown files (with the .md extension) are converted to
+// XHTML content documents and add the headings to the table of contents.
+type File struct {
+	Path       string   `json:"path"`                 // Name of the file.
+	Title      string   `json:"title,omitempty"`      // Title of the table of contents entry.
+	Linear     *bool    `json:"linear,omitempty"`     // Whether the file is the primary content; true by default.
+	Properties []string `json:"properties,omitempty"` // Manifest item properties, such as “scripted” or “svg”.
+}
+
+// UnmarshalJSON implements json.Unmarshaler interface.
+func (f *File) UnmarshalJSON(data []byte) error {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte(`"`)) {
+		return json.Unmarshal(data, &f.Path)
+	}
+	type file File // avoid recursion
+	return json.Unmarshal(data, (*file)(f))
+}
+
+// Unmarshal parses the book description in the given format: “yaml”, “json” or
+// “toml”.
+func Unmarshal(data []byte, format string) (*Book, error) {
+	var value interface{}
+	switch strings.ToLower(format) {
+	case "json":
+		value = json.RawMessage(data)
+	case "yaml", "yml":
+		if err := yaml.Unmarshal(data, &value); err != nil {
+			return nil, err
+		}
+	case "toml":
+		if err := toml.Unmarshal(data, &value); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported book description format %q", format)
+	}
+	// all formats are decoded through JSON to share the field names; numbers
+	// of YAML and TOML are used as strings, such as the year or the ISBN
+	data, err := json.Marshal(numbersToStrings(value))
+	if err != nil {
+		return nil, err
+	}
+	book := new(Book)
+	if err := json.Unmarshal(data, book); err != nil {
+		return nil, err
+	}
+	return book, nil
+}
+
+// numbersToStrings replaces the numbers of the decoded YAML or TOML value with
+// their string representation.
+func numbersToStrings(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = numbersToStrings(item)
+		}
+	case []map[string]interface{}: // TOML array of tables
+		for _, item := range v {
+			numbersToStrings(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = numbersToStrings(item)
+		}
+	case int:
+		return strconv.Itoa(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case uint64:
+		return strconv.FormatUint(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return value
+}
+
+// Load reads the book description from the file system. The format is defined
+// by the file name extension.
+func Load(fsys fs.FS, name string) (*Book, error) {
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	book, err := Unmarshal(data, strings.TrimPrefix(path.Ext(name), "."))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return book, nil
+}
+
+// Metadata returns the publication metadata defined in the book description.
+// The roles, sort names, identifier schemes and series are defined as
+// refinements.
+func (b *Book) Metadata() (epub.Metadata, error) {
+	var m epub.Metadata
+	if b.Title != "" {
+		m.Title = []epub.ElementLang{{Value: b.Title, ID: "title"}}
+		if b.Subtitle != "" {
+			m.Title = append(m.Title, epub.ElementLang{Value: b.Subtitle, ID: "subtitle"})
+			m.Meta = append(m.Meta,
+				epub.Meta{Refines: "#title", Property: "title-type", Value: "main"},
+				epub.Meta{Refines: "#subtitle", Property: "title-type", Value: "subtitle"})
+		}
+	}
+	if b.Lang != "" {
+		if err := m.SetLang(b.Lang); err != nil {
+			return m, err
+		}
+	}
+
+	// identifiers
+	for i, identifier := range b.Identifiers {
+		id := "pub-id"
+		if i > 0 {
+			id = "id" + strconv.Itoa(i)
+		}
+		value := identifier.Value
+		switch scheme := strings.ToLower(identifier.Scheme); scheme {
+		case "":
+		case "isbn", "uuid", "issn":
+			if !strings.HasPrefix(value, "urn:") {
+				value = "urn:" + scheme + ":" + value
+			}
+		default:
+			m.Meta = append(m.Meta, epub.Meta{Refines: "#" + id,
+				Property: "identifier-type", Value: identifier.Scheme})
+		}
+		m.Identifier = append(m.Identifier, epub.Element{Value: value, ID: id})
+	}
+
+	// creators and contributors
+	for _, list := range []struct {
+		authors []Author
+		prefix  string
+		dest    *[]epub.ElementLang
+	}{
+		{b.Authors, "creator", &m.Creator},
+		{b.Contributors, "contributor", &m.Contributor},
+	} {
+		for i, author := range list.authors {
+			id := fmt.Sprintf("%s%02d", list.prefix, i+1)
+			*list.dest = append(*list.dest, epub.ElementLang{Value: author.Name, ID: id})
+			if author.Role != "" {
+				m.Meta = append(m.Meta, epub.Meta{Refines: "#" + id, Property: "role",
+					Scheme: "marc:relators", Value: author.Role})
+			}
+			if author.FileAs != "" {
+				m.Meta = append(m.Meta, epub.Meta{Refines: "#" + id, Property: "file-as",
+					Value: author.FileAs})
+			}
+		}
+	}
+
+	// series
+	if b.Series != nil && b.Series.Name != "" {
+		m.Meta = append(m.Meta,
+			epub.Meta{ID: "series", Property: "belongs-to-collection", Value: b.Series.Name},
+			epub.Meta{Refines: "#series", Property: "collection-type", Value: "series"})
+		if b.Series.Position != 0 {
+			m.Meta = append(m.Meta, epub.Meta{Refines: "#series", Property: "group-position",
+				Value: strconv.FormatFloat(b.Series.Position, 'f', -1, 64)})
+		}
+	}
+
+	m.AddSubjects(b.Subjects...)
+	if b.Description != "" {
+		m.SetDescription(b.Description)
+	}
+	if b.Publisher != "" {
+		m.SetPublisher(b.Publisher)
+	}
+	if b.Rights != "" {
+		m.SetRights(b.Rights)
+	}
+	if b.Date != "" {
+		date := b.Date
+		// dates decoded from YAML and TOML are converted to timestamps
+		if t, err := time.Parse(time.RFC3339, date); err == nil && t.Equal(t.Truncate(24*time.Hour)) {
+			date = t.Format("2006-01-02")
+		}
+		m.Date = &epub.Element{Value: date}
+		if _, err := m.PublicationDate(); err != nil {
+			return m, err
+		}
+	}
+	return m, nil
+}
+
+// Build writes the publication described by the book to w. The files are read
+// from the file system. Front matter of Markdown files overrides the metadata
+// of the description, the authors and subjects are added to the defined ones
+// without duplicates. On error w holds the incomplete data that is not a
+// readable publication and should be discarded.
+func (b *Book) Build(w io.Writer, fsys fs.FS, opts ...epub.Option) error {
+	metadata, err := b.Metadata()
+	if err != nil {
+		return err
+	}
+	pub, err := epub.New(w, opts...)
+	if err != nil {
+		return err
+	}
+	if err := b.build(pub, fsys, metadata); err != nil {
+		pub.Abort() // do not write the incomplete publication
+		return err
+	}
+	return pub.Close()
+}
+
+// build adds the metadata and the files to the publication.
+func (b *Book) build(pub *epub.Writer, fsys fs.FS, metadata epub.Metadata) error {
+	pub.Metadata = metadata
+	if b.Cover != "" {
+		if err := addFile(pub, fsys, b.Cover, epub.Media, "cover-image"); err != nil {
+			return err
+		}
+	}
+
+	// markdown converter
+	var opts []markdown.Option
+	if b.Stylesheet != "" {
+		css, err := fs.ReadFile(fsys, b.Stylesheet)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, markdown.WithStylesheet(b.Stylesheet, css))
+	}
+	converter, err := markdown.NewBuilder(pub.Rendition, opts...)
+	if err != nil {
+		return err
+	}
+
+	// content files
+	for _, file := range b.Files {
+		if strings.EqualFold(path.Ext(file.Path), ".md") {
+			source, err := fs.ReadFile(fsys, file.Path)
+			if err != nil {
+				return err
+			}
+			if err := converter.Add(file.Path, source); err != nil {
+				return err
+			}
+			continue
+		}
+		ct := epub.Primary
+		if file.Linear != nil && !*file.Linear {
+			ct = epub.Auxiliary
+		}
+		if err := addFile(pub, fsys, file.Path, ct, file.Properties...); err != nil {
+			return err
+		}
+		if file.Title != "" {
+			pub.AddTOC(file.Title, file.Path)
+		}
+	}
+
+	// resources
+	added := make(map[string]bool)
+	for _, name := range append([]string{b.Cover, b.Stylesheet}, filePaths(b.Files)...) {
+		added[name] = true
+	}
+	for _, pattern := range b.Resources {
+		names, err := fs.Glob(fsys, pattern)
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			if added[name] {
+				continue
+			}
+			added[name] = true
+			if err := addFile(pub, fsys, name, epub.Media); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// filePaths returns the names of the content files.
+func filePaths(files []File) []string {
+	names := make([]string, len(files))
+	for i, file := range files {
+		names[i] = file.Path
+	}
+	return names
+}
+
+// addFile adds the file from the file system to the publication.
+func addFile(pub *epub.Writer, fsys fs.FS, name string, ct epub.ContentType, properties ...string) error {
+	file, err := fsys.Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return pub.AddContent(file, name, ct, properties...)
+}
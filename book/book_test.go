@@ -0,0 +1,72 @@
+package book_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+	"testing/fstest"
+
+	"github.com/mdigger/epub3/book"
+)
+
+func TestUnmarshalNumbers(t *testing.T) {
+	sources := map[string]string{
+		"yaml": `title: 1984
+date: 2020
+identifiers: [9780000000000]
+series: {name: Series, position: 2.5}
+files: [chapter.md]
+`,
+		"toml": `title = 1984
+date = 2020
+files = ["chapter.md"]
+
+[[identifiers]]
+value = 9780000000000
+scheme = "isbn"
+
+[series]
+name = "Series"
+position = 2.5
+`,
+		"json": `{"title": "1984", "date": "2020", "identifiers": ["9780000000000"],
+"series": {"name": "Series", "position": 2.5}, "files": ["chapter.md"]}`,
+	}
+	for format, source := range sources {
+		b, err := book.Unmarshal([]byte(source), format)
+		if err != nil {
+			t.Errorf("%s: %v", format, err)
+			continue
+		}
+		if b.Title != "1984" || b.Date != "2020" {
+			t.Errorf("%s: title = %q, date = %q", format, b.Title, b.Date)
+		}
+		if len(b.Identifiers) != 1 || b.Identifiers[0].Value != "9780000000000" {
+			t.Errorf("%s: identifiers = %v", format, b.Identifiers)
+		}
+		if b.Series == nil || b.Series.Name != "Series" || b.Series.Position != 2.5 {
+			t.Errorf("%s: series = %v", format, b.Series)
+		}
+		if len(b.Files) != 1 || b.Files[0].Path != "chapter.md" {
+			t.Errorf("%s: files = %v", format, b.Files)
+		}
+		if _, err := b.Metadata(); err != nil {
+			t.Errorf("%s: metadata: %v", format, err)
+		}
+	}
+}
+
+func TestBuildError(t *testing.T) {
+	b := &book.Book{
+		Title: "Book",
+		Files: []book.File{{Path: "one.md"}, {Path: "missing.md"}},
+	}
+	fsys := fstest.MapFS{"one.md": {Data: []byte("# One\n")}}
+	var buf bytes.Buffer
+	if err := b.Build(&buf, fsys); err == nil {
+		t.Fatal("error is expected for the missing file")
+	}
+	if _, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len())); err == nil {
+		t.Error("incomplete publication is readable")
+	}
+}
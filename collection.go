@@ -0,0 +1,97 @@
+package epub
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Reserved collection roles.
+const (
+	CollectionIndex         = "index"                // Index of the publication.
+	CollectionIndexGroup    = "index-group"          // Group of index documents (sub-collection of index).
+	CollectionDictionary    = "dictionary"           // Dictionary content.
+	CollectionGlossary      = "glossary"             // Glossary content.
+	CollectionPreview       = "preview"              // Preview content of the publication.
+	CollectionDistributable = "distributable-object" // Resources that can be distributed separately.
+	CollectionManifest      = "manifest"             // Resources of the distributable object.
+)
+
+// AddCollection adds new top-level collection with the given role to the
+// publication package and returns it for filling.
+func (r *Rendition) AddCollection(role string) *Collection {
+	collection := &Collection{Role: role}
+	r.collections = append(r.collections, collection)
+	return collection
+}
+
+// AddCollection adds new sub-collection with the given role and returns it for
+// filling.
+func (c *Collection) AddCollection(role string) *Collection {
+	collection := &Collection{Role: role}
+	c.Collections = append(c.Collections, collection)
+	return collection
+}
+
+// AddLinks adds links to the publication resources to the collection. The
+// names are the same as used in AddContent and may contain fragment
+// identifiers.
+func (c *Collection) AddLinks(names ...string) {
+	for _, name := range names {
+		c.Links = append(c.Links, Link{Href: name})
+	}
+}
+
+// checkCollections checks the collections roles and links to the publication
+// resources. Metadata of collections gets the Dublin Core namespace
+// declaration if it is not defined.
+func checkCollections(collections []*Collection, manifest []Item) error {
+	for _, collection := range collections {
+		if collection.Role == "" {
+			return fmt.Errorf("collection role is not defined")
+		}
+		if collection.Metadata != nil {
+			if collection.Metadata.DC == "" {
+				collection.Metadata.DC = nsDC
+			}
+			if err := checkMetadataLinks(collection.Metadata.Link); err != nil {
+				return fmt.Errorf("collection %q: %w", collection.Role, err)
+			}
+		}
+		for _, link := range collection.Links {
+			href := link.Href
+			if i := strings.IndexByte(href, '#'); i >= 0 {
+				href = href[:i]
+			}
+			if !inManifest(manifest, href) {
+				return fmt.Errorf("collection %q: link %q is not found in the manifest",
+					collection.Role, link.Href)
+			}
+		}
+		if err := checkCollections(collection.Collections, manifest); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkMetadataLinks checks that the metadata links define the relationship:
+// unlike the links of collections, the rel attribute of the metadata link is
+// required.
+func checkMetadataLinks(links []Link) error {
+	for _, link := range links {
+		if strings.TrimSpace(link.Rel) == "" {
+			return fmt.Errorf("metadata link %q: rel is not defined", link.Href)
+		}
+	}
+	return nil
+}
+
+// inManifest returns true if the manifest contains an item with the href.
+func inManifest(manifest []Item, href string) bool {
+	for _, item := range manifest {
+		if item.Href == href {
+			return true
+		}
+	}
+	return false
+}
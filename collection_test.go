@@ -0,0 +1,54 @@
+package epub_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	epub "github.com/mdigger/epub3"
+)
+
+func TestMetadataLinkRel(t *testing.T) {
+	tests := []struct {
+		name string
+		add  func(pub *epub.Writer)
+		err  string
+	}{
+		{"package link", func(pub *epub.Writer) {
+			pub.Link = append(pub.Link, epub.Link{Href: "record.xml", Rel: "record"})
+		}, ""},
+		{"package link without rel", func(pub *epub.Writer) {
+			pub.Link = append(pub.Link, epub.Link{Href: "record.xml"})
+		}, `metadata link "record.xml": rel is not defined`},
+		{"collection link without rel", func(pub *epub.Writer) {
+			pub.AddCollection(epub.CollectionPreview).AddLinks("chapter.xhtml")
+		}, ""},
+		{"collection metadata link without rel", func(pub *epub.Writer) {
+			collection := pub.AddCollection(epub.CollectionPreview)
+			collection.AddLinks("chapter.xhtml")
+			collection.Metadata = &epub.Metadata{Link: []epub.Link{{Href: "record.xml"}}}
+		}, `collection "preview": metadata link "record.xml": rel is not defined`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			pub, err := epub.New(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			pub.AddTitle("Test")
+			if err := pub.AddContent(strings.NewReader(testDocument("Chapter", "Text.")),
+				"chapter.xhtml", epub.Primary); err != nil {
+				t.Fatal(err)
+			}
+			test.add(pub)
+			err = pub.Close()
+			switch {
+			case test.err == "" && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case test.err != "" && (err == nil || err.Error() != test.err):
+				t.Errorf("error %v, want %q", err, test.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package epub
+
+import (
+	"bytes"
+	"context"
+)
+
+// addNCX generates the EPUB 2 navigation control file with the table of
+// contents and adds it to the publication if it is not already added.
+func (r *Rendition) addNCX(ctx context.Context, metadata *Metadata, uid string) error {
+	for _, item := range r.manifest {
+		if item.MediaType == "application/x-dtbncx+xml" {
+			return nil
+		}
+	}
+	for _, item := range metadata.Identifier {
+		if item.ID == uid {
+			uid = item.Value
+			break
+		}
+	}
+	var title string
+	if len(metadata.Title) > 0 {
+		title = metadata.Title[0].Value
+	}
+	data, err := ncxDocument(uid, title, metadata.Lang(), r.navPoints())
+	if err != nil {
+		return err
+	}
+	return r.addContent(ctx, bytes.NewReader(data), NCXFilename, "application/x-dtbncx+xml",
+		Media, nil)
+}
+
+// compat adds to the package the EPUB 2 navigation control file reference,
+// the guide with the landmarks and the cover meta, so EPUB 2 reading systems
+// can use the publication. The EPUB 2 attributes of the metadata elements are
+// converted to the refinements.
+func (r *Rendition) compat(pkg *Package) {
+	pkg.Metadata.Meta = append([]Meta(nil), pkg.Metadata.Meta...)
+	for _, item := range pkg.Manifest.Items {
+		switch {
+		case item.MediaType == "application/x-dtbncx+xml":
+			pkg.Spine.Toc = item.ID
+		case hasProperty(item.Properties, "cover-image"):
+			var defined bool
+			for _, meta := range pkg.Metadata.Meta {
+				if meta.Name == "cover" {
+					defined = true
+					break
+				}
+			}
+			if !defined {
+				pkg.Metadata.Meta = append(pkg.Metadata.Meta,
+					Meta{Name: "cover", Content: item.ID})
+			}
+		}
+	}
+
+	// guide references
+	if len(r.landmarks) > 0 {
+		pkg.Guide = new(Guide)
+		for _, landmark := range r.landmarks {
+			typ := "other." + landmark.Type
+			for reference, name := range guideLandmarks {
+				if name == landmark.Type {
+					typ = reference
+					break
+				}
+			}
+			pkg.Guide.References = append(pkg.Guide.References,
+				Reference{Type: typ, Title: landmark.Title, Href: landmark.Href})
+		}
+	}
+
+	// EPUB 2 attributes of the metadata elements are not valid in EPUB 3
+	// packages: copy the lists to not change the Writer metadata
+	m := &pkg.Metadata
+	m.Identifier = append([]Element(nil), m.Identifier...)
+	m.Creator = append([]ElementLang(nil), m.Creator...)
+	m.Contributor = append([]ElementLang(nil), m.Contributor...)
+	ids := m.ids()
+	for _, item := range pkg.Manifest.Items {
+		ids[item.ID] = true
+	}
+	m.refineEPUB2Attrs(ids)
+	if m.Date != nil && m.Date.Event != "" {
+		date := *m.Date
+		date.Event = ""
+		m.Date = &date
+	}
+}
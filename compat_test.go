@@ -0,0 +1,90 @@
+package epub_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	epub "github.com/mdigger/epub3"
+	"github.com/mdigger/epub3/validate"
+)
+
+func TestEPUB2Compatible(t *testing.T) {
+	var buf bytes.Buffer
+	pub, err := epub.New(&buf, epub.EPUB2Compatible())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub.AddTitle("Compatible")
+	pub.Identifier = []epub.Element{{Value: "urn:isbn:9780000000000", ID: "pub-id"}}
+	pub.Creator = []epub.ElementLang{{Value: "John Smith", ID: "creator01"},
+		{Value: "Jane Doe", Role: "ill", FileAs: "Doe, Jane"}} // EPUB 2 attributes
+	pub.Meta = append(pub.Meta,
+		epub.Meta{Refines: "#creator01", Property: "role", Scheme: "marc:relators", Value: "aut"},
+		epub.Meta{Refines: "#creator01", Property: "file-as", Value: "Smith, John"})
+	for _, name := range []string{"one.xhtml", "two.xhtml"} {
+		if err := pub.AddContent(strings.NewReader(testDocument(name, "Text")),
+			name, epub.Primary); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pub.AddTOC("One", "one.xhtml")
+	pub.AddTOC("Two", "two.xhtml")
+	pub.AddLandmark("bodymatter", "Start", "one.xhtml")
+	if err := pub.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(pub.Creator) != 2 || pub.Creator[1].Role != "ill" || pub.Creator[1].ID != "" ||
+		len(pub.Meta) != 2 {
+		t.Errorf("Writer metadata is changed: %+v %+v", pub.Creator, pub.Meta)
+	}
+
+	messages, err := validate.Zip(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, msg := range messages {
+		t.Error(msg)
+	}
+
+	pkg, err := epub.ReadPackage(strings.NewReader(readTestFile(t, buf.Bytes(), "OEBPS/package.opf")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ncx string
+	for _, item := range pkg.Manifest.Items {
+		if item.ID == pkg.Spine.Toc {
+			ncx = item.Href
+		}
+	}
+	if ncx != epub.NCXFilename {
+		t.Errorf("spine toc refers to %q, want %q", ncx, epub.NCXFilename)
+	}
+	opf := readTestFile(t, buf.Bytes(), "OEBPS/package.opf")
+	if strings.Contains(opf, "opf:") {
+		t.Errorf("package contains EPUB 2 attributes:\n%s", opf)
+	}
+	refinements := make(map[string]string)
+	for _, meta := range pkg.Metadata.Meta {
+		refinements[meta.Refines+" "+meta.Property] = meta.Value
+	}
+	for i, want := range [][2]string{{"aut", "Smith, John"}, {"ill", "Doe, Jane"}} {
+		creator := pkg.Metadata.Creator[i]
+		if creator.ID == "" || refinements["#"+creator.ID+" role"] != want[0] ||
+			refinements["#"+creator.ID+" file-as"] != want[1] {
+			t.Errorf("creator %q refinements = %v", creator.Value, refinements)
+		}
+	}
+	if pkg.Guide == nil || len(pkg.Guide.References) != 1 ||
+		pkg.Guide.References[0].Type != "text" || pkg.Guide.References[0].Href != "one.xhtml" {
+		t.Errorf("guide = %+v", pkg.Guide)
+	}
+
+	data, err := epub.ReadNCX(strings.NewReader(readTestFile(t, buf.Bytes(), "OEBPS/"+epub.NCXFilename)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data.NavMap) != 2 || data.NavMap[1].Content.Src != "two.xhtml" {
+		t.Errorf("NCX navigation map = %+v", data.NavMap)
+	}
+}
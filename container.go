@@ -4,21 +4,55 @@ import (
 	"encoding/xml"
 )
 
-// Default file names and mime-type.
-var (
-	RootPath        = "OEBPS"       // Folder with content of publication
-	PackageFilename = "package.opf" // Package description file name
+// Names of the multiple-rendition publication files.
+const (
+	ContainerMetadataFilename = "META-INF/metadata.xml" // Release identifier of the publication
+	MappingFilename           = "mapping.xhtml"         // Rendition mapping document
 )
 
+// nsRendition is the namespace of the rendition selection attributes.
+const nsRendition = "http://www.idpf.org/2013/rendition"
+
 // RootFile describes the path to description of publication.
 type RootFile struct {
 	FullPath  string `xml:"full-path,attr"`
 	MediaType string `xml:"media-type,attr"`
+	Selection
+}
+
+// Selection describes the rendition selection attributes used by reading
+// systems to choose the rendition of multiple-rendition publication.
+type Selection struct {
+	Media      string `xml:"rendition:media,attr,omitempty"`      // A CSS media query, such as “(orientation: landscape)”.
+	Layout     string `xml:"rendition:layout,attr,omitempty"`     // Layout of the rendition: reflowable or pre-paginated.
+	Language   string `xml:"rendition:language,attr,omitempty"`   // Language of the rendition (BCP 47).
+	AccessMode string `xml:"rendition:accessMode,attr,omitempty"` // Access mode: auditory, tactile, textual or visual.
+	Label      string `xml:"rendition:label,attr,omitempty"`      // Human-readable name of the rendition.
 }
 
 // Container describes the contents of the container.
 type Container struct {
-	XMLName   xml.Name   `xml:"urn:oasis:names:tc:opendocument:xmlns:container container"`
-	Version   string     `xml:"version,attr"`
-	Rootfiles []RootFile `xml:"rootfiles>rootfile"`
+	XMLName   xml.Name        `xml:"urn:oasis:names:tc:opendocument:xmlns:container container"`
+	Version   string          `xml:"version,attr"`
+	Rendition string          `xml:"xmlns:rendition,attr,omitempty"` // “http://www.idpf.org/2013/rendition”
+	Rootfiles []RootFile      `xml:"rootfiles>rootfile"`
+	Links     []ContainerLink `xml:"links>link,omitempty"`
+}
+
+// ContainerLink describes the link to the container-level resource, such as
+// the rendition mapping document.
+type ContainerLink struct {
+	Href      string `xml:"href,attr"`
+	Rel       string `xml:"rel,attr"`
+	MediaType string `xml:"media-type,attr,omitempty"`
+}
+
+// ContainerMetadata describes the release identifier of the multiple-rendition
+// publication (META-INF/metadata.xml).
+type ContainerMetadata struct {
+	XMLName          xml.Name  `xml:"http://www.idpf.org/2013/metadata metadata"`
+	DC               string    `xml:"xmlns:dc,attr"` // “http://purl.org/dc/elements/1.1/”
+	UniqueIdentifier string    `xml:"unique-identifier,attr"`
+	Identifier       []Element `xml:"dc:identifier"`
+	Meta             []Meta    `xml:"meta"`
 }
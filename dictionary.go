@@ -0,0 +1,132 @@
+package epub
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"path/filepath"
+
+	"github.com/mdigger/epub3/internal/ocf"
+	"golang.org/x/text/language"
+)
+
+// SearchKeyMapType is the media type of the Search Key Map Document.
+const SearchKeyMapType = "application/vnd.epub.search-key-map+xml"
+
+// SearchKeyMap element is the root of the Search Key Map Document: the list of
+// search keys of the dictionary and the locations of their entries.
+type SearchKeyMap struct {
+	XMLName xml.Name         `xml:"http://www.idpf.org/2007/ops search-key-map"`
+	Lang    string           `xml:"xml:lang,attr,omitempty"` // Specifies the language of the search keys.
+	Groups  []SearchKeyGroup `xml:"search-key-group"`        // List of the search key groups.
+}
+
+// SearchKeyGroup element groups search keys of one dictionary entry.
+type SearchKeyGroup struct {
+	Href    string           `xml:"href,attr"` // A reference to the dictionary entry in the content document.
+	Matches []SearchKeyMatch `xml:"match"`     // Search keys of the entry.
+}
+
+// SearchKeyMatch element defines the search key of the dictionary entry.
+type SearchKeyMatch struct {
+	Value  string           `xml:"value,attr"` // The search key.
+	Values []SearchKeyValue `xml:"value"`      // Alternative forms of the search key, such as inflected forms.
+}
+
+// SearchKeyValue element defines an alternative form of the search key.
+type SearchKeyValue struct {
+	Value string `xml:"value,attr"` // The alternative form of the search key.
+}
+
+// Dictionary describes the dictionary or glossary of the publication.
+type Dictionary struct {
+	Title      string           // Title of the dictionary.
+	SourceLang string           // Language of the dictionary entries (BCP 47).
+	TargetLang string           // Language of the entries definitions (BCP 47).
+	Content    []string         // Names of the content documents with dictionary entries.
+	Keys       []SearchKeyGroup // Search keys of the dictionary entries. References are relative to the root folder.
+}
+
+// AddDictionary adds the dictionary to the publication: the collection with
+// the dictionary role and the Search Key Map Document with the given name.
+// Content documents must be added with the "dictionary" property using
+// AddContent.
+func (r *Rendition) AddDictionary(name string, dict Dictionary) error {
+	if err := r.addDictionary(CollectionDictionary, name, dict); err != nil {
+		return err
+	}
+	// mark publication as dictionary
+	for _, item := range r.Type {
+		if item.Value == "dictionary" {
+			return nil
+		}
+	}
+	r.Type = append(r.Type, Element{Value: "dictionary"})
+	return nil
+}
+
+// AddGlossary adds the glossary to the publication: the collection with the
+// glossary role and, if the name is not empty, the Search Key Map Document.
+// Content documents must be added with the "glossary" property using
+// AddContent.
+func (r *Rendition) AddGlossary(name string, dict Dictionary) error {
+	return r.addDictionary(CollectionGlossary, name, dict)
+}
+
+// addDictionary adds the dictionary collection with the given role to the
+// publication.
+func (r *Rendition) addDictionary(role, name string, dict Dictionary) error {
+	for _, lang := range []string{dict.SourceLang, dict.TargetLang} {
+		if lang == "" {
+			continue
+		}
+		if _, err := language.Parse(lang); err != nil {
+			return fmt.Errorf("%s: bad language tag %q: %w", role, lang, err)
+		}
+	}
+
+	// dictionary metadata
+	metadata := new(Metadata)
+	if dict.Title != "" {
+		metadata.AddTitle(dict.Title)
+	}
+	if role == CollectionDictionary {
+		metadata.Type = []Element{{Value: "dictionary"}}
+	}
+	if dict.SourceLang != "" {
+		metadata.Meta = append(metadata.Meta,
+			Meta{Property: "source-language", Value: dict.SourceLang})
+	}
+	if dict.TargetLang != "" {
+		metadata.Meta = append(metadata.Meta,
+			Meta{Property: "target-language", Value: dict.TargetLang})
+	}
+	collection := &Collection{Role: role, Metadata: metadata}
+
+	// write search key map document
+	if name != "" {
+		name = filepath.ToSlash(name) // normalize file name
+		skm := SearchKeyMap{
+			Lang:   dict.SourceLang,
+			Groups: make([]SearchKeyGroup, len(dict.Keys)),
+		}
+		for i, group := range dict.Keys {
+			group.Href = ocf.Relative(name, group.Href)
+			skm.Groups[i] = group
+		}
+		var buf bytes.Buffer
+		if err := encodeXML(&buf, "", skm); err != nil {
+			return err
+		}
+		if err := r.addContent(context.Background(), &buf, name, SearchKeyMapType, Media,
+			[]string{"search-key-map", role}); err != nil {
+			return err
+		}
+		collection.AddLinks(name)
+	}
+
+	collection.AddLinks(dict.Content...)
+	r.collections = append(r.collections, collection)
+	return nil
+}
@@ -0,0 +1,383 @@
+package epub
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/mdigger/epub3/internal/ocf"
+)
+
+// Editor modifies the existing publication: the metadata, the manifest and the
+// spine of the package, and the publication files. The Write method writes
+// the modified publication; the unchanged files are copied without
+// recompression. Only the package of the default (first) rendition is edited,
+// the files of other renditions are copied unchanged.
+type Editor struct {
+	*Package // package of the default rendition
+	config
+	zip     *zip.Reader       // source publication
+	name    string            // package file name
+	root    string            // folder with content of the package
+	files   map[string][]byte // added and replaced files
+	removed map[string]bool   // removed files
+}
+
+// NewEditor returns the Editor of the publication read from r, which has the
+// given size. The WithClock, WithModTime, PreserveModified, Strict and
+// ConvertHTML options are used.
+func NewEditor(r io.ReaderAt, size int64, opts ...Option) (*Editor, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	data, err := readZipFile(zr, ContainerFilename)
+	if err != nil {
+		return nil, err
+	}
+	container, err := ReadContainer(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", ContainerFilename, err)
+	}
+	if len(container.Rootfiles) == 0 {
+		return nil, fmt.Errorf("%s: package document is not defined", ContainerFilename)
+	}
+	name := container.Rootfiles[0].FullPath
+	data, err = readZipFile(zr, name)
+	if err != nil {
+		return nil, err
+	}
+	pkg, err := ReadPackage(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return &Editor{
+		Package: pkg,
+		config:  newConfig(opts),
+		zip:     zr,
+		name:    name,
+		root:    path.Dir(name),
+		files:   make(map[string][]byte),
+		removed: make(map[string]bool),
+	}, nil
+}
+
+// readZipFile returns the content of the archive file.
+func readZipFile(zr *zip.Reader, name string) ([]byte, error) {
+	file, err := zr.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return io.ReadAll(file)
+}
+
+// Open returns the content of the publication file. The name is relative to
+// the package folder. The added and replaced files return the new content.
+func (e *Editor) Open(name string) (io.ReadCloser, error) {
+	name = path.Join(e.root, filepath.ToSlash(name))
+	if data, ok := e.files[name]; ok {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+	if e.removed[name] {
+		return nil, fmt.Errorf("file %q is removed from the publication", name)
+	}
+	return e.zip.Open(name)
+}
+
+// item returns the index of the manifest item of the file with the name
+// relative to the container root or -1 if it is not in the manifest.
+func (e *Editor) item(name string) int {
+	for i, item := range e.Manifest.Items {
+		if href, ok := ocf.Resolve(e.root, item.Href); ok && href == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// exists returns true if the file with the name relative to the container root
+// is in the publication.
+func (e *Editor) exists(name string) bool {
+	if _, ok := e.files[name]; ok {
+		return true
+	}
+	if e.removed[name] {
+		return false
+	}
+	file, err := e.zip.Open(name)
+	if err != nil {
+		return false
+	}
+	file.Close()
+	return true
+}
+
+// read returns the content of the added file and checks it in strict mode.
+func (e *Editor) read(content io.Reader, name, mediaType string) ([]byte, error) {
+	data, err := io.ReadAll(content)
+	if err != nil {
+		return nil, err
+	}
+	if e.strict && mediaType == "application/xhtml+xml" {
+		if err := checkXHTML(name, data); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// Add adds the file to the publication and to the manifest. The name is
+// relative to the package folder. Content files are added to the end of the
+// spine as in Writer.AddContent. With the ConvertHTML option HTML files are
+// converted to XHTML content documents as in Writer.AddContent.
+func (e *Editor) Add(content io.Reader, name string, ct ContentType, properties ...string) error {
+	href := filepath.ToSlash(name)
+	name = path.Join(e.root, href)
+	if e.exists(name) || e.item(name) >= 0 {
+		return fmt.Errorf("a file with the name %q has already been added to the publication", href)
+	}
+	mediaType := typeByName(name)
+	if ext := strings.ToLower(path.Ext(name)); e.convertHTML &&
+		(ext == ".html" || ext == ".htm") {
+		var buf bytes.Buffer
+		if err := HTMLToXHTML(&buf, content); err != nil {
+			return fmt.Errorf("%s: %w", href, err)
+		}
+		content, mediaType = &buf, "application/xhtml+xml"
+	}
+	data, err := e.read(content, name, mediaType)
+	if err != nil {
+		return err
+	}
+
+	// generate unique item id
+	ids := e.Metadata.ids()
+	for _, item := range e.Manifest.Items {
+		ids[item.ID] = true
+	}
+	var id string
+	for i := len(e.Manifest.Items) + 1; ; i++ {
+		if id = fmt.Sprintf("id%02x", i); !ids[id] {
+			break
+		}
+	}
+	e.Manifest.Items = append(e.Manifest.Items, Item{
+		ID:         id,
+		Href:       href,
+		MediaType:  mediaType,
+		Properties: strings.Join(properties, " "),
+	})
+	if ct < Media {
+		itemref := ItemRef{IDRef: id}
+		if ct == Auxiliary {
+			itemref.Linear = "no"
+		}
+		e.Spine.ItemRefs = append(e.Spine.ItemRefs, itemref)
+	}
+	delete(e.removed, name)
+	e.files[name] = data
+	return nil
+}
+
+// Replace replaces the content of the publication file. The name is relative
+// to the package folder. The manifest is not changed.
+func (e *Editor) Replace(content io.Reader, name string) error {
+	name = path.Join(e.root, filepath.ToSlash(name))
+	if !e.exists(name) {
+		return fmt.Errorf("file %q is not found in the publication", name)
+	}
+	if name == e.name {
+		return fmt.Errorf("package document %q is written from the Package", name)
+	}
+	mediaType := typeByName(name)
+	if i := e.item(name); i >= 0 {
+		mediaType = e.Manifest.Items[i].MediaType
+	}
+	data, err := e.read(content, name, mediaType)
+	if err != nil {
+		return err
+	}
+	e.files[name] = data
+	return nil
+}
+
+// Remove removes the file from the publication, the manifest and the spine.
+// The name is relative to the package folder. The references to the file from
+// other files are not changed.
+func (e *Editor) Remove(name string) error {
+	name = path.Join(e.root, filepath.ToSlash(name))
+	if !e.exists(name) {
+		return fmt.Errorf("file %q is not found in the publication", name)
+	}
+	if name == e.name || name == ContainerFilename || name == "mimetype" {
+		return fmt.Errorf("file %q is required", name)
+	}
+	if i := e.item(name); i >= 0 {
+		id := e.Manifest.Items[i].ID
+		e.Manifest.Items = append(e.Manifest.Items[:i], e.Manifest.Items[i+1:]...)
+		itemrefs := e.Spine.ItemRefs[:0]
+		for _, itemref := range e.Spine.ItemRefs {
+			if itemref.IDRef != id {
+				itemrefs = append(itemrefs, itemref)
+			}
+		}
+		e.Spine.ItemRefs = itemrefs
+	}
+	delete(e.files, name)
+	e.removed[name] = true
+	return nil
+}
+
+// SetSpineOrder changes the reading order: the content documents with the
+// names relative to the package folder are placed at the beginning of the
+// spine in the given order, followed by the other spine documents in their
+// current order.
+func (e *Editor) SetSpineOrder(names ...string) error {
+	itemrefs := make([]ItemRef, 0, len(e.Spine.ItemRefs))
+	used := make(map[int]bool, len(names))
+	for _, name := range names {
+		i := e.item(path.Join(e.root, filepath.ToSlash(name)))
+		if i < 0 {
+			return fmt.Errorf("file %q is not found in the manifest", name)
+		}
+		j := -1
+		for k, itemref := range e.Spine.ItemRefs {
+			if itemref.IDRef == e.Manifest.Items[i].ID && !used[k] {
+				j = k
+				break
+			}
+		}
+		if j < 0 {
+			return fmt.Errorf("file %q is not found in the spine", name)
+		}
+		used[j] = true
+		itemrefs = append(itemrefs, e.Spine.ItemRefs[j])
+	}
+	for i, itemref := range e.Spine.ItemRefs {
+		if !used[i] {
+			itemrefs = append(itemrefs, itemref)
+		}
+	}
+	e.Spine.ItemRefs = itemrefs
+	return nil
+}
+
+// Write writes the modified publication to w. The package document is
+// written from the Package with the updated modification time (unless the
+// PreserveModified option is used); the unchanged files are copied without
+// recompression, the added files are written at the end in lexical order.
+// On error w holds the incomplete data that is not a readable publication.
+func (e *Editor) Write(w io.Writer) error {
+	return e.WriteContext(context.Background(), w)
+}
+
+// WriteContext is like Write but stops writing the publication and returns
+// the context error when the context is done.
+func (e *Editor) WriteContext(ctx context.Context, w io.Writer) error {
+	if e.preserveModified || e.Metadata.modified {
+		modified := -1
+		for i, item := range e.Metadata.Meta {
+			if item.Property == "dcterms:modified" && item.Refines == "" {
+				modified = i
+				break
+			}
+		}
+		if modified < 0 {
+			return fmt.Errorf("dcterms:modified is not defined")
+		}
+		if err := checkModified(e.Metadata.Meta[modified].Value); err != nil {
+			return err
+		}
+	} else {
+		e.Metadata.SetMetaDate("dcterms:modified", e.clock(), PrecisionSecond)
+	}
+	var pkg bytes.Buffer
+	if err := encodeXML(&pkg, "", e.Package); err != nil {
+		return err
+	}
+
+	// the zip writer is not closed on error to not write the central
+	// directory of the incomplete publication
+	sink := newZipSink(w, e.modTime)
+
+	// write mimetype first
+	file, err := sink.Create("mimetype")
+	if err != nil {
+		return err
+	}
+	if _, err = io.WriteString(file, "application/epub+zip"); err != nil {
+		return err
+	}
+
+	// copy the source files
+	written := make(map[string]bool, len(e.files))
+	for _, src := range e.zip.File {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		name := src.Name
+		switch data, ok := e.files[name]; {
+		case name == "mimetype" || e.removed[name] || written[name]:
+			continue
+		case name == e.name:
+			data, ok = pkg.Bytes(), true
+			fallthrough
+		case ok:
+			written[name] = true
+			header := &zip.FileHeader{
+				Name:         name,
+				Method:       zip.Deflate,
+				ModifiedTime: src.ModifiedTime,
+				ModifiedDate: src.ModifiedDate,
+			}
+			if !e.modTime.IsZero() {
+				header.ModifiedTime, header.ModifiedDate = msDosTime(e.modTime)
+			}
+			file, err := sink.CreateHeader(header)
+			if err != nil {
+				return err
+			}
+			if _, err := file.Write(data); err != nil {
+				return err
+			}
+		default:
+			written[name] = true
+			if err := sink.Copy(src); err != nil {
+				return err
+			}
+		}
+	}
+
+	// write added files
+	names := make([]string, 0, len(e.files))
+	for name := range e.files {
+		if !written[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	created := e.modTime
+	if created.IsZero() {
+		created = e.clock()
+	}
+	for _, name := range names {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		file, err := sink.create(name, created)
+		if err != nil {
+			return err
+		}
+		if _, err := file.Write(e.files[name]); err != nil {
+			return err
+		}
+	}
+	return sink.Close()
+}
@@ -0,0 +1,106 @@
+package epub_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	epub "github.com/mdigger/epub3"
+	"github.com/mdigger/epub3/validate"
+)
+
+func TestEditor(t *testing.T) {
+	src := writeTestPublication(t)
+	modified := time.Date(2022, 5, 6, 7, 8, 9, 0, time.UTC)
+	editor, err := epub.NewEditor(bytes.NewReader(src), int64(len(src)),
+		epub.ConvertHTML(), epub.WithClock(func() time.Time { return modified }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	editor.Metadata.Title[0].Value = "Edited"
+	if err := editor.Add(strings.NewReader(`<p>Appendix<br>text`), "text/appendix.html",
+		epub.Auxiliary); err != nil {
+		t.Fatal(err)
+	}
+	if err := editor.Replace(strings.NewReader(testDocument("One", "Replaced.")),
+		"text/chapter1.xhtml"); err != nil {
+		t.Fatal(err)
+	}
+	if err := editor.Remove("images/cover.svg"); err != nil {
+		t.Fatal(err)
+	}
+	if err := editor.SetSpineOrder("text/chapter2.xhtml"); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := editor.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	messages, err := validate.Zip(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, msg := range messages {
+		t.Error(msg)
+	}
+
+	pkg, err := epub.ReadPackage(strings.NewReader(readTestFile(t, data, "OEBPS/package.opf")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if title := pkg.Metadata.Title[0].Value; title != "Edited" {
+		t.Errorf("title = %q, want Edited", title)
+	}
+	if got, _ := pkg.Metadata.Modified(); !got.Equal(modified) {
+		t.Errorf("modified = %v, want %v", got, modified)
+	}
+	hrefs := make(map[string]epub.Item)
+	for _, item := range pkg.Manifest.Items {
+		hrefs[item.ID] = item
+	}
+	var spine []string
+	for _, itemref := range pkg.Spine.ItemRefs {
+		spine = append(spine, hrefs[itemref.IDRef].Href)
+	}
+	if want := "text/chapter2.xhtml text/chapter1.xhtml text/appendix.html"; strings.Join(spine, " ") != want {
+		t.Errorf("spine = %v, want %s", spine, want)
+	}
+	for _, item := range pkg.Manifest.Items {
+		switch item.Href {
+		case "images/cover.svg":
+			t.Error("removed file is in the manifest")
+		case "text/appendix.html":
+			if item.MediaType != "application/xhtml+xml" {
+				t.Errorf("media type of the converted HTML = %q", item.MediaType)
+			}
+		}
+	}
+	if doc := readTestFile(t, data, "OEBPS/text/chapter1.xhtml"); !strings.Contains(doc, "Replaced.") {
+		t.Errorf("file is not replaced:\n%s", doc)
+	}
+	if doc := readTestFile(t, data, "OEBPS/text/appendix.html"); !strings.Contains(doc, "<br/>") {
+		t.Errorf("HTML is not converted:\n%s", doc)
+	}
+}
+
+func TestEditorWriteCanceled(t *testing.T) {
+	src := writeTestPublication(t)
+	editor, err := epub.NewEditor(bytes.NewReader(src), int64(len(src)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var buf bytes.Buffer
+	if err := editor.WriteContext(ctx, &buf); err != context.Canceled {
+		t.Fatalf("error = %v, want %v", err, context.Canceled)
+	}
+	if _, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len())); err == nil {
+		t.Error("incomplete publication is readable")
+	}
+}
@@ -0,0 +1,632 @@
+// Package fb2 converts FictionBook 2 documents to EPUB publications: the book
+// description is mapped to the publication metadata, the sections of the main
+// body to the content documents with the table of contents, the notes to the
+// footnotes and the embedded images to the publication resources.
+package fb2
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	epub "github.com/mdigger/epub3"
+	"golang.org/x/net/html/charset"
+)
+
+// ImagesDir is the folder of the publication with images extracted from the
+// FictionBook document.
+const ImagesDir = "images"
+
+// node is the element of the FictionBook document.
+type node struct {
+	name     string
+	attrs    []xml.Attr
+	children []interface{} // *node or string
+}
+
+// attr returns the value of the attribute with the given local name.
+func (n *node) attr(name string) string {
+	for _, attr := range n.attrs {
+		if attr.Name.Local == name {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// child returns the first child element with the given name.
+func (n *node) child(name string) *node {
+	if n == nil {
+		return nil
+	}
+	for _, child := range n.children {
+		if child, ok := child.(*node); ok && child.name == name {
+			return child
+		}
+	}
+	return nil
+}
+
+// all returns the child elements with the given name.
+func (n *node) all(name string) []*node {
+	if n == nil {
+		return nil
+	}
+	var list []*node
+	for _, child := range n.children {
+		if child, ok := child.(*node); ok && child.name == name {
+			list = append(list, child)
+		}
+	}
+	return list
+}
+
+// text returns the plain text of the element with normalized spaces. The
+// paragraphs are separated by the separator.
+func (n *node) text(separator string) string {
+	if n == nil {
+		return ""
+	}
+	var parts []string
+	var inline strings.Builder
+	for _, child := range n.children {
+		switch child := child.(type) {
+		case string:
+			inline.WriteString(child)
+		case *node:
+			switch child.name {
+			case "p", "v", "subtitle", "text-author":
+				parts = append(parts, child.text(" "))
+			default:
+				inline.WriteString(child.text(separator))
+			}
+		}
+	}
+	if text := strings.Join(strings.Fields(inline.String()), " "); text != "" {
+		parts = append([]string{text}, parts...)
+	}
+	return strings.Join(parts, separator)
+}
+
+// parse returns the root element of the FictionBook document. The document
+// encoding is defined by the XML declaration.
+func parse(src io.Reader) (*node, error) {
+	dec := xml.NewDecoder(src)
+	dec.CharsetReader = charset.NewReaderLabel
+	dec.Entity = xml.HTMLEntity
+	root := &node{}
+	stack := []*node{root}
+	for {
+		token, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		parent := stack[len(stack)-1]
+		switch t := token.(type) {
+		case xml.StartElement:
+			n := &node{name: t.Name.Local, attrs: t.Attr}
+			parent.children = append(parent.children, n)
+			stack = append(stack, n)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			parent.children = append(parent.children, string(t))
+		}
+	}
+	for _, child := range root.children {
+		if child, ok := child.(*node); ok {
+			if child.name != "FictionBook" {
+				return nil, fmt.Errorf("not a FictionBook document: root element %q", child.name)
+			}
+			return child, nil
+		}
+	}
+	return nil, errors.New("not a FictionBook document: no root element")
+}
+
+// Import converts the FictionBook document and adds it to the publication
+// rendition, such as the default rendition of the Writer. The description of
+// the book replaces the title and is added to other metadata.
+func Import(r *epub.Rendition, src io.Reader) error {
+	book, err := parse(src)
+	if err != nil {
+		return err
+	}
+	description := book.child("description")
+	if err := setMetadata(&r.Metadata, description); err != nil {
+		return err
+	}
+	c := &converter{
+		rendition: r,
+		ids:       make(map[string]string),
+		images:    make(map[string]string),
+	}
+
+	// images
+	var cover string
+	if image := description.child("title-info").child("coverpage").child("image"); image != nil {
+		cover = strings.TrimPrefix(image.attr("href"), "#")
+	}
+	for _, binary := range book.all("binary") {
+		if err := c.addImage(binary, binary.attr("id") == cover); err != nil {
+			return err
+		}
+	}
+
+	// assign file names to bodies and sections
+	var files []file
+	for _, body := range book.all("body") {
+		switch name := body.attr("name"); name {
+		case "notes", "comments":
+			files = append(files, file{name: name + ".xhtml", body: body, notes: true})
+		default:
+			var intro *node // body content before sections
+			for _, child := range body.children {
+				child, ok := child.(*node)
+				if !ok {
+					continue
+				}
+				if child.name != "section" {
+					if intro == nil {
+						intro = &node{name: "body"}
+					}
+					intro.children = append(intro.children, child)
+					continue
+				}
+				files = append(files, file{body: child})
+			}
+			if intro != nil {
+				files = append([]file{{body: intro, intro: true}}, files...)
+			}
+		}
+	}
+	var n int
+	for i := range files {
+		if files[i].name == "" {
+			n++
+			files[i].name = fmt.Sprintf("text%03d.xhtml", n)
+		}
+		c.collectIDs(files[i].body, files[i].name)
+	}
+
+	// content documents
+	for _, file := range files {
+		if err := c.addFile(file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// file describes the content document converted from the FictionBook body or
+// section.
+type file struct {
+	name  string
+	body  *node
+	intro bool // body content before sections
+	notes bool // notes body
+}
+
+// converter converts the FictionBook elements to XHTML.
+type converter struct {
+	rendition *epub.Rendition
+	ids       map[string]string // content document names by element ID
+	images    map[string]string // image file names by binary ID
+	buf       bytes.Buffer      // content of the document
+	generated int               // counter of generated identifiers
+}
+
+// addImage adds the embedded image to the publication.
+func (c *converter) addImage(binary *node, cover bool) error {
+	id := binary.attr("id")
+	data, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(binary.text("")), ""))
+	if err != nil {
+		return fmt.Errorf("binary %q: %w", id, err)
+	}
+	name := path.Base(id)
+	if path.Ext(name) == "" {
+		switch binary.attr("content-type") {
+		case "image/jpeg":
+			name += ".jpg"
+		case "image/png":
+			name += ".png"
+		case "image/gif":
+			name += ".gif"
+		case "image/svg+xml":
+			name += ".svg"
+		}
+	}
+	name = path.Join(ImagesDir, name)
+	var properties []string
+	if cover {
+		properties = append(properties, "cover-image")
+	}
+	if err := c.rendition.AddContent(bytes.NewReader(data), name, epub.Media, properties...); err != nil {
+		return err
+	}
+	c.images[id] = name
+	return nil
+}
+
+// collectIDs registers the identifiers of elements in the content document.
+func (c *converter) collectIDs(n *node, name string) {
+	if id := n.attr("id"); id != "" {
+		c.ids[id] = name
+	}
+	for _, child := range n.children {
+		if child, ok := child.(*node); ok {
+			c.collectIDs(child, name)
+		}
+	}
+}
+
+// addFile converts the content document and adds it to the publication.
+func (c *converter) addFile(f file) error {
+	title := f.body.child("title").text(" ")
+	if title == "" && len(c.rendition.Title) > 0 {
+		title = c.rendition.Title[0].Value
+	}
+	c.buf.Reset()
+	ct := epub.Primary
+	var toc []tocEntry
+	switch {
+	case f.notes:
+		ct = epub.Auxiliary
+		if title == "" || f.body.child("title") == nil {
+			title = strings.ToUpper(f.name[:1]) + strings.TrimSuffix(f.name[1:], ".xhtml")
+		}
+		c.writeNotes(f.body)
+		toc = []tocEntry{{title: title}}
+	case f.intro:
+		c.writeBlocks(f.body, 1, nil)
+		toc = []tocEntry{{title: title}}
+	default:
+		toc = c.writeSection(f.body, 1)
+	}
+
+	// document
+	var doc bytes.Buffer
+	doc.WriteString(xml.Header)
+	doc.WriteString("<!DOCTYPE html>\n<html xmlns=\"http://www.w3.org/1999/xhtml\" xmlns:epub=\"http://www.idpf.org/2007/ops\"")
+	if lang := c.rendition.Lang(); lang != "" {
+		fmt.Fprintf(&doc, ` xml:lang="%s" lang="%s"`, escape(lang), escape(lang))
+	}
+	fmt.Fprintf(&doc, ">\n<head>\n<title>%s</title>\n</head>\n<body>\n", escape(title))
+	doc.Write(c.buf.Bytes())
+	doc.WriteString("</body>\n</html>\n")
+	if err := c.rendition.AddContent(&doc, f.name, ct); err != nil {
+		return err
+	}
+
+	// table of contents
+	for _, entry := range toc {
+		if entry.title == "" {
+			continue
+		}
+		entry.add(c.rendition.AddTOC(entry.title, f.name), f.name)
+	}
+	return nil
+}
+
+// tocEntry is the table of contents entry of the section.
+type tocEntry struct {
+	title    string
+	id       string
+	children []tocEntry
+}
+
+// add adds the nested entries to the table of contents.
+func (e tocEntry) add(point *epub.NavPoint, name string) {
+	for _, child := range e.children {
+		if child.title == "" {
+			child.add(point, name) // entries of sections without title
+			continue
+		}
+		child.add(point.Add(child.title, name+"#"+child.id), name)
+	}
+}
+
+// writeSection writes the section with the heading of the given level and
+// returns its table of contents entries.
+func (c *converter) writeSection(section *node, level int) []tocEntry {
+	id := section.attr("id")
+	title := section.child("title").text(" ")
+	if id == "" && title != "" && level > 1 {
+		c.generated++
+		id = "section-" + strconv.Itoa(c.generated)
+	}
+	c.buf.WriteString("<section")
+	if id != "" {
+		fmt.Fprintf(&c.buf, ` id="%s"`, escape(id))
+	}
+	c.buf.WriteString(">\n")
+	var children []tocEntry
+	c.writeBlocks(section, level, &children)
+	c.buf.WriteString("</section>\n")
+	return []tocEntry{{title: title, id: id, children: children}}
+}
+
+// writeBlocks writes the block elements of the section. The table of contents
+// entries of nested sections are added to the toc.
+func (c *converter) writeBlocks(parent *node, level int, toc *[]tocEntry) {
+	for _, child := range parent.children {
+		n, ok := child.(*node)
+		if !ok {
+			continue
+		}
+		switch n.name {
+		case "section":
+			entries := c.writeSection(n, level+1)
+			if toc != nil {
+				*toc = append(*toc, entries...)
+			}
+		case "title":
+			h := "h" + strconv.Itoa(min(level, 6))
+			c.buf.WriteString("<" + h + ">")
+			for i, p := range n.all("p") {
+				if i > 0 {
+					c.buf.WriteString("<br/>")
+				}
+				c.writeInline(p)
+			}
+			c.buf.WriteString("</" + h + ">\n")
+		case "p":
+			c.writeElement("p", n, "")
+		case "subtitle", "text-author", "v", "date":
+			c.writeElement("p", n, n.name)
+		case "empty-line":
+			c.buf.WriteString("<br/>\n")
+		case "image":
+			c.buf.WriteString(`<div class="image">`)
+			c.writeImage(n)
+			c.buf.WriteString("</div>\n")
+		case "epigraph", "cite":
+			fmt.Fprintf(&c.buf, "<blockquote class=\"%s\">\n", n.name)
+			c.writeBlocks(n, level, nil)
+			c.buf.WriteString("</blockquote>\n")
+		case "poem", "stanza", "annotation":
+			fmt.Fprintf(&c.buf, "<div class=\"%s\">\n", n.name)
+			if title := n.child("title"); title != nil {
+				c.buf.WriteString(`<p class="title">`)
+				c.buf.WriteString(escape(title.text(" ")))
+				c.buf.WriteString("</p>\n")
+			}
+			blocks := &node{name: n.name}
+			for _, block := range n.children {
+				if block, ok := block.(*node); ok && block.name != "title" {
+					blocks.children = append(blocks.children, block)
+				}
+			}
+			c.writeBlocks(blocks, level, nil)
+			c.buf.WriteString("</div>\n")
+		case "table":
+			c.buf.WriteString("<table>\n")
+			for _, row := range n.all("tr") {
+				c.buf.WriteString("<tr>")
+				for _, cell := range row.children {
+					if cell, ok := cell.(*node); ok && (cell.name == "td" || cell.name == "th") {
+						c.buf.WriteString("<" + cell.name)
+						for _, attr := range []string{"colspan", "rowspan"} {
+							if value := cell.attr(attr); value != "" {
+								fmt.Fprintf(&c.buf, ` %s="%s"`, attr, escape(value))
+							}
+						}
+						c.buf.WriteString(">")
+						c.writeInline(cell)
+						c.buf.WriteString("</" + cell.name + ">")
+					}
+				}
+				c.buf.WriteString("</tr>\n")
+			}
+			c.buf.WriteString("</table>\n")
+		default:
+			c.writeBlocks(n, level, toc)
+		}
+	}
+}
+
+// writeNotes writes the sections of the notes body as footnotes.
+func (c *converter) writeNotes(body *node) {
+	if title := body.child("title"); title != nil {
+		c.writeBlocks(&node{children: []interface{}{title}}, 1, nil)
+	}
+	for _, section := range body.all("section") {
+		c.buf.WriteString(`<aside epub:type="footnote"`)
+		if id := section.attr("id"); id != "" {
+			fmt.Fprintf(&c.buf, ` id="%s"`, escape(id))
+		}
+		c.buf.WriteString(">\n")
+		c.writeBlocks(section, 2, nil)
+		c.buf.WriteString("</aside>\n")
+	}
+}
+
+// writeElement writes the element with the inline content of the node.
+func (c *converter) writeElement(name string, n *node, class string) {
+	c.buf.WriteString("<" + name)
+	if id := n.attr("id"); id != "" {
+		fmt.Fprintf(&c.buf, ` id="%s"`, escape(id))
+	}
+	if class != "" {
+		fmt.Fprintf(&c.buf, ` class="%s"`, class)
+	}
+	c.buf.WriteString(">")
+	c.writeInline(n)
+	c.buf.WriteString("</" + name + ">\n")
+}
+
+// inlineElements maps the FictionBook inline elements to XHTML.
+var inlineElements = map[string]string{
+	"strong":        "strong",
+	"emphasis":      "em",
+	"style":         "span",
+	"strikethrough": "del",
+	"sub":           "sub",
+	"sup":           "sup",
+	"code":          "code",
+}
+
+// writeInline writes the inline content of the element.
+func (c *converter) writeInline(parent *node) {
+	for _, child := range parent.children {
+		switch n := child.(type) {
+		case string:
+			c.buf.WriteString(escape(n))
+		case *node:
+			switch name := inlineElements[n.name]; {
+			case name != "":
+				c.buf.WriteString("<" + name + ">")
+				c.writeInline(n)
+				c.buf.WriteString("</" + name + ">")
+			case n.name == "a":
+				c.writeLink(n)
+			case n.name == "image":
+				c.writeImage(n)
+			default:
+				c.writeInline(n)
+			}
+		}
+	}
+}
+
+// writeLink writes the link. The references to the notes are marked as note
+// references.
+func (c *converter) writeLink(n *node) {
+	href := n.attr("href")
+	if id, ok := strings.CutPrefix(href, "#"); ok {
+		if name := c.ids[id]; name != "" {
+			href = name + href
+		}
+	}
+	c.buf.WriteString(`<a href="` + escape(href) + `"`)
+	if n.attr("type") == "note" {
+		c.buf.WriteString(` epub:type="noteref"`)
+	}
+	c.buf.WriteString(">")
+	c.writeInline(n)
+	c.buf.WriteString("</a>")
+}
+
+// writeImage writes the reference to the embedded image.
+func (c *converter) writeImage(n *node) {
+	src := n.attr("href")
+	if name, ok := c.images[strings.TrimPrefix(src, "#")]; ok {
+		src = name
+	}
+	fmt.Fprintf(&c.buf, `<img src="%s" alt="%s"/>`, escape(src), escape(n.attr("alt")))
+}
+
+// escape returns the text with escaped XML special characters.
+func escape(s string) string {
+	var buf strings.Builder
+	xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
+
+// setMetadata adds the book description to the publication metadata.
+func setMetadata(m *epub.Metadata, description *node) error {
+	info := description.child("title-info")
+	if title := info.child("book-title").text(" "); title != "" {
+		m.Title = []epub.ElementLang{{Value: title}}
+	}
+	addPersons(m, &m.Creator, "creator", "aut", info.all("author"))
+	addPersons(m, &m.Contributor, "contributor", "trl", info.all("translator"))
+	for _, genre := range info.all("genre") {
+		m.AddSubjects(genre.text(" "))
+	}
+	for _, keyword := range strings.Split(info.child("keywords").text(" "), ",") {
+		if keyword = strings.TrimSpace(keyword); keyword != "" {
+			m.AddSubjects(keyword)
+		}
+	}
+	if annotation := info.child("annotation").text("\n"); annotation != "" {
+		m.SetDescription(annotation)
+	}
+	if lang := info.child("lang").text(" "); lang != "" {
+		if err := m.SetLang(lang); err != nil {
+			return err
+		}
+	}
+	if date := info.child("date"); date != nil {
+		value := date.attr("value")
+		if value == "" {
+			value = date.text(" ")
+		}
+		for _, format := range []struct {
+			layout    string
+			precision epub.DatePrecision
+		}{
+			{"2006-01-02", epub.PrecisionDay},
+			{"2006-01", epub.PrecisionMonth},
+			{"2006", epub.PrecisionYear},
+		} {
+			if t, err := time.Parse(format.layout, value); err == nil {
+				m.SetDate(t, format.precision)
+				break
+			}
+		}
+	}
+	if sequence := info.child("sequence"); sequence != nil && sequence.attr("name") != "" {
+		id := m.NewID("series")
+		m.Meta = append(m.Meta,
+			epub.Meta{ID: id, Property: "belongs-to-collection", Value: sequence.attr("name")},
+			epub.Meta{Refines: "#" + id, Property: "collection-type", Value: "series"})
+		if number := sequence.attr("number"); number != "" {
+			m.Meta = append(m.Meta,
+				epub.Meta{Refines: "#" + id, Property: "group-position", Value: number})
+		}
+	}
+
+	// publication info and identifiers
+	publish := description.child("publish-info")
+	if publisher := publish.child("publisher").text(" "); publisher != "" {
+		m.SetPublisher(publisher)
+	}
+	if isbn := publish.child("isbn").text(" "); isbn != "" {
+		m.Identifier = append(m.Identifier, epub.Element{
+			Value: "urn:isbn:" + strings.ReplaceAll(isbn, " ", ""), ID: m.NewID("isbn")})
+	}
+	if id := description.child("document-info").child("id").text(" "); id != "" {
+		identifier := epub.Element{Value: id}
+		if len(m.Identifier) == 0 {
+			identifier.ID = m.NewID("uid")
+		}
+		m.Identifier = append(m.Identifier, identifier)
+	}
+	return nil
+}
+
+// addPersons adds the persons with the role and the sort name to the list of
+// creators or contributors.
+func addPersons(m *epub.Metadata, list *[]epub.ElementLang, prefix, role string, persons []*node) {
+	for _, person := range persons {
+		first := person.child("first-name").text(" ")
+		middle := person.child("middle-name").text(" ")
+		last := person.child("last-name").text(" ")
+		name := strings.Join(strings.Fields(strings.Join([]string{first, middle, last}, " ")), " ")
+		if name == "" {
+			name = person.child("nickname").text(" ")
+		}
+		if name == "" {
+			continue
+		}
+		id := m.NewID(prefix)
+		*list = append(*list, epub.ElementLang{Value: name, ID: id})
+		m.Meta = append(m.Meta, epub.Meta{Refines: "#" + id, Property: "role",
+			Scheme: "marc:relators", Value: role})
+		if last != "" && first != "" {
+			m.Meta = append(m.Meta, epub.Meta{Refines: "#" + id, Property: "file-as",
+				Value: strings.TrimSpace(last + ", " + first + " " + middle)})
+		}
+	}
+}
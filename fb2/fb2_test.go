@@ -0,0 +1,220 @@
+package fb2_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	epub "github.com/mdigger/epub3"
+	"github.com/mdigger/epub3/fb2"
+	"golang.org/x/text/encoding/charmap"
+)
+
+// testBook is the FictionBook document in windows-1251 encoding.
+const testBook = `<?xml version="1.0" encoding="windows-1251"?>
+<FictionBook xmlns="http://www.gribuser.ru/xml/fictionbook/2.0" xmlns:l="http://www.w3.org/1999/xlink">
+<description>
+<title-info>
+<genre>prose</genre>
+<author><first-name>Лев</first-name><middle-name>Николаевич</middle-name><last-name>Толстой</last-name></author>
+<book-title>Война и мир</book-title>
+<annotation><p>Роман.</p><p>Эпопея.</p></annotation>
+<keywords>война, мир</keywords>
+<date value="1869-01-01">1869</date>
+<coverpage><image l:href="#cover.jpg"/></coverpage>
+<lang>ru</lang>
+<translator><first-name>Louise</first-name><last-name>Maude</last-name></translator>
+<sequence name="Классика" number="2"/>
+</title-info>
+<document-info><id>doc-1</id></document-info>
+<publish-info><publisher>Издательство</publisher><isbn>978 5 00000 000 0</isbn></publish-info>
+</description>
+<body>
+<title><p>Война и мир</p></title>
+<epigraph><p>Эпиграф.</p></epigraph>
+<section id="ch1">
+<title><p>Глава 1</p></title>
+<p>Текст &laquo;главы&raquo;<a l:href="#n1" type="note">1</a>.</p>
+<section><title><p>Часть</p></title><p>Вложенный <emphasis>текст</emphasis>.</p></section>
+</section>
+</body>
+<body name="notes">
+<title><p>Примечания</p></title>
+<section id="n1"><title><p>1</p></title><p>Примечание.</p></section>
+</body>
+<binary id="cover.jpg" content-type="image/jpeg">
+/9j/4CBpbWFn
+ZSBkYXRh
+</binary>
+</FictionBook>`
+
+// testImage is the content of the cover image.
+const testImage = "\xff\xd8\xff\xe0 image data"
+
+// readFile returns the content of the file from the publication archive.
+func readFile(t *testing.T, data []byte, name string) string {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := zr.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	content, err := io.ReadAll(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+func TestImport(t *testing.T) {
+	src, err := charmap.Windows1251.NewEncoder().String(testBook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	pub, err := epub.New(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fb2.Import(pub.Rendition, strings.NewReader(src)); err != nil {
+		t.Fatal(err)
+	}
+	if err := pub.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	// metadata
+	pkg, err := epub.ReadPackage(strings.NewReader(readFile(t, data, "OEBPS/package.opf")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := pkg.Metadata
+	if len(m.Title) != 1 || m.Title[0].Value != "Война и мир" {
+		t.Errorf("title = %v", m.Title)
+	}
+	if m.Lang() != "ru" {
+		t.Errorf("language = %q, want ru", m.Lang())
+	}
+	if len(m.Identifier) != 2 || m.Identifier[0].Value != "urn:isbn:9785000000000" ||
+		m.Identifier[1].Value != "doc-1" || pkg.UniqueIdentifier != m.Identifier[0].ID {
+		t.Errorf("identifiers = %v, unique identifier %q", m.Identifier, pkg.UniqueIdentifier)
+	}
+	if len(m.Creator) != 1 || m.Creator[0].Value != "Лев Николаевич Толстой" {
+		t.Errorf("creators = %v", m.Creator)
+	}
+	if len(m.Contributor) != 1 || m.Contributor[0].Value != "Louise Maude" {
+		t.Errorf("contributors = %v", m.Contributor)
+	}
+	if m.Date == nil || m.Date.Value != "1869-01-01" {
+		t.Errorf("date = %v", m.Date)
+	}
+	if len(m.Description) != 1 || m.Description[0].Value != "Роман.\nЭпопея." {
+		t.Errorf("description = %v", m.Description)
+	}
+	if len(m.Publisher) != 1 || m.Publisher[0].Value != "Издательство" {
+		t.Errorf("publisher = %v", m.Publisher)
+	}
+	var subjects []string
+	for _, subject := range m.Subject {
+		subjects = append(subjects, subject.Value)
+	}
+	if strings.Join(subjects, ",") != "prose,война,мир" {
+		t.Errorf("subjects = %q", subjects)
+	}
+	refined := make(map[string]string)
+	for _, meta := range m.Meta {
+		refined[meta.Refines+" "+meta.Property] = meta.Value
+	}
+	for key, want := range map[string]string{
+		"#" + m.Creator[0].ID + " role":     "aut",
+		"#" + m.Creator[0].ID + " file-as":  "Толстой, Лев Николаевич",
+		"#" + m.Contributor[0].ID + " role": "trl",
+		" belongs-to-collection":            "Классика",
+	} {
+		if refined[key] != want {
+			t.Errorf("meta %q = %q, want %q", key, refined[key], want)
+		}
+	}
+
+	// embedded image
+	if image := readFile(t, data, "OEBPS/images/cover.jpg"); image != testImage {
+		t.Errorf("image = %q, want %q", image, testImage)
+	}
+	var cover bool
+	for _, item := range pkg.Manifest.Items {
+		if item.Href == "images/cover.jpg" && item.Properties == "cover-image" {
+			cover = true
+		}
+	}
+	if !cover {
+		t.Errorf("cover image is not defined: %v", pkg.Manifest.Items)
+	}
+
+	// sections and notes
+	for name, wants := range map[string][]string{
+		"OEBPS/text001.xhtml": {"<title>Война и мир</title>", "<h1>Война и мир</h1>",
+			"<blockquote class=\"epigraph\">\n<p>Эпиграф.</p>"},
+		"OEBPS/text002.xhtml": {`<section id="ch1">`, "<h1>Глава 1</h1>",
+			`<p>Текст «главы»<a href="notes.xhtml#n1" epub:type="noteref">1</a>.</p>`,
+			"<h2>Часть</h2>", "<em>текст</em>"},
+		"OEBPS/notes.xhtml": {"<h1>Примечания</h1>", `<aside epub:type="footnote" id="n1">`,
+			"<p>Примечание.</p>"},
+		"OEBPS/nav.xhtml": {`<a href="text001.xhtml">Война и мир</a>`,
+			`<a href="text002.xhtml">Глава 1</a>`, `<a href="text002.xhtml#section-1">Часть</a>`,
+			`<a href="notes.xhtml">Примечания</a>`},
+	} {
+		content := readFile(t, data, name)
+		for _, want := range wants {
+			if !strings.Contains(content, want) {
+				t.Errorf("%s does not contain %s:\n%s", name, want, content)
+			}
+		}
+	}
+	notes := pkg.Spine.ItemRefs[len(pkg.Spine.ItemRefs)-1]
+	if notes.Linear != "no" {
+		t.Errorf("notes are in the linear reading order: %v", pkg.Spine.ItemRefs)
+	}
+}
+
+func TestImportIdentifiers(t *testing.T) {
+	const src = `<FictionBook><description>
+<title-info><book-title>Book</book-title>
+<sequence name="Series"/></title-info>
+<document-info><id>doc-2</id></document-info>
+<publish-info><isbn>9785000000001</isbn></publish-info>
+</description><body><section><p>Text</p></section></body></FictionBook>`
+	pub, err := epub.New(io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pub.Close()
+	// identifiers that are already in use
+	pub.Identifier = []epub.Element{{Value: "urn:uuid:1", ID: "isbn01"}}
+	pub.Meta = []epub.Meta{{ID: "series01", Property: "belongs-to-collection", Value: "Other"}}
+	if err := fb2.Import(pub.Rendition, strings.NewReader(src)); err != nil {
+		t.Fatal(err)
+	}
+	ids := make(map[string]bool)
+	for _, item := range pub.Identifier {
+		if item.ID != "" && ids[item.ID] {
+			t.Errorf("duplicate identifier ID %q", item.ID)
+		}
+		ids[item.ID] = true
+	}
+	for _, meta := range pub.Meta {
+		if meta.ID != "" && ids[meta.ID] {
+			t.Errorf("duplicate meta ID %q", meta.ID)
+		}
+		ids[meta.ID] = true
+	}
+	if len(pub.Identifier) != 3 || pub.Identifier[1].Value != "urn:isbn:9785000000001" {
+		t.Errorf("identifiers = %v", pub.Identifier)
+	}
+}
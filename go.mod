@@ -1,3 +1,11 @@
 module github.com/mdigger/epub3
 
-go 1.16
+go 1.21
+
+require (
+	github.com/BurntSushi/toml v1.6.0
+	github.com/yuin/goldmark v1.7.8
+	golang.org/x/net v0.35.0
+	golang.org/x/text v0.22.0
+	gopkg.in/yaml.v3 v3.0.1
+)
@@ -0,0 +1,212 @@
+package epub
+
+import (
+	"bufio"
+	"encoding/xml"
+	"io"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Namespaces of foreign elements embedded in HTML documents.
+const (
+	nsSVG    = "http://www.w3.org/2000/svg"
+	nsMathML = "http://www.w3.org/1998/Math/MathML"
+	nsXLink  = "http://www.w3.org/1999/xlink"
+)
+
+// Escapers of XML text and attribute values.
+var (
+	textEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+	attrEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;",
+		`"`, "&quot;", "\t", "&#x9;", "\n", "&#xA;", "\r", "&#xD;")
+)
+
+// voidElements lists the HTML elements without content.
+var voidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true,
+	"hr": true, "img": true, "input": true, "link": true, "meta": true,
+	"param": true, "source": true, "track": true, "wbr": true,
+}
+
+// HTMLToXHTML parses the HTML document and writes it as polyglot XHTML content
+// document: with the XML declaration, the HTML5 document type declaration, the
+// XHTML, epub, SVG and MathML namespaces, closed empty elements and escaped
+// character entities. The title element is added if it is missing.
+func HTMLToXHTML(dst io.Writer, src io.Reader) error {
+	doc, err := html.Parse(src)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(dst)
+	w.WriteString(xml.Header)
+	w.WriteString("<!DOCTYPE html>\n")
+	for node := doc.FirstChild; node != nil; node = node.NextSibling {
+		switch node.Type {
+		case html.ElementNode:
+			addTitle(node)
+			writeXHTML(w, node, true)
+			w.WriteByte('\n')
+		case html.CommentNode:
+			writeXHTML(w, node, false)
+			w.WriteByte('\n')
+		}
+	}
+	return w.Flush()
+}
+
+// addTitle adds the empty title element to the head of the document if it is
+// missing.
+func addTitle(root *html.Node) {
+	for head := root.FirstChild; head != nil; head = head.NextSibling {
+		if head.Type != html.ElementNode || head.DataAtom != atom.Head {
+			continue
+		}
+		for node := head.FirstChild; node != nil; node = node.NextSibling {
+			if node.Type == html.ElementNode && node.DataAtom == atom.Title {
+				return
+			}
+		}
+		head.InsertBefore(&html.Node{Type: html.ElementNode, Data: "title",
+			DataAtom: atom.Title}, head.FirstChild)
+		return
+	}
+}
+
+// writeXHTML writes the node as XHTML. The root flag marks the root element of
+// the document, which declares the namespaces.
+func writeXHTML(w *bufio.Writer, node *html.Node, root bool) {
+	switch node.Type {
+	case html.TextNode:
+		textEscaper.WriteString(w, xmlChars(node.Data))
+	case html.CommentNode:
+		w.WriteString("<!--")
+		w.WriteString(strings.ReplaceAll(xmlChars(node.Data), "--", "- -"))
+		w.WriteString("-->")
+	case html.ElementNode:
+		if !isXMLName(node.Data) {
+			// not a valid XML name, e.g. with undeclared prefix: write only the content
+			for child := node.FirstChild; child != nil; child = child.NextSibling {
+				writeXHTML(w, child, false)
+			}
+			return
+		}
+		w.WriteByte('<')
+		w.WriteString(node.Data)
+		switch {
+		case root:
+			w.WriteString(` xmlns="` + nsXHTML + `"`)
+			if usesEpubNamespace(node) {
+				w.WriteString(` xmlns:epub="` + nsOPS + `"`)
+			}
+		case node.Namespace == "svg" && node.Parent.Namespace != "svg":
+			w.WriteString(` xmlns="` + nsSVG + `" xmlns:xlink="` + nsXLink + `"`)
+		case node.Namespace == "math" && node.Parent.Namespace != "math":
+			w.WriteString(` xmlns="` + nsMathML + `"`)
+		}
+		var lang, xmlLang string
+		for _, attr := range node.Attr {
+			name := attr.Key
+			if attr.Namespace != "" {
+				name = attr.Namespace + ":" + attr.Key
+			}
+			switch {
+			case name == "xmlns" || strings.HasPrefix(name, "xmlns:"):
+				continue // namespaces are declared above
+			case !isXMLAttr(name, node.Namespace == "svg"):
+				continue // not allowed in XML or has undeclared prefix
+			case name == "lang":
+				lang = attr.Val
+			case name == "xml:lang":
+				xmlLang = attr.Val
+			}
+			writeAttr(w, name, attr.Val)
+		}
+		if lang != "" && xmlLang == "" && node.Namespace == "" {
+			writeAttr(w, "xml:lang", lang) // polyglot documents define both attributes
+		}
+		if node.FirstChild == nil && (voidElements[node.Data] || node.Namespace != "") {
+			w.WriteString("/>")
+			return
+		}
+		w.WriteByte('>')
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			writeXHTML(w, child, false)
+		}
+		w.WriteString("</")
+		w.WriteString(node.Data)
+		w.WriteByte('>')
+	}
+}
+
+// writeAttr writes the attribute with the escaped value.
+func writeAttr(w *bufio.Writer, name, value string) {
+	w.WriteByte(' ')
+	w.WriteString(name)
+	w.WriteString(`="`)
+	attrEscaper.WriteString(w, xmlChars(value))
+	w.WriteByte('"')
+}
+
+// xmlChars removes the characters not allowed in XML documents: control
+// characters other than tab, line feed and carriage return, and the
+// noncharacters U+FFFE and U+FFFF.
+func xmlChars(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r < 0x20 && r != '\t' && r != '\n' && r != '\r', r == 0xfffe, r == 0xffff:
+			return -1
+		default:
+			return r
+		}
+	}, s)
+}
+
+// usesEpubNamespace returns true if the element or its descendants have
+// attributes with the epub prefix.
+func usesEpubNamespace(node *html.Node) bool {
+	for _, attr := range node.Attr {
+		if strings.HasPrefix(attr.Key, "epub:") {
+			return true
+		}
+	}
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		if usesEpubNamespace(child) {
+			return true
+		}
+	}
+	return false
+}
+
+// isXMLAttr returns true if the name is a valid XML attribute name without
+// prefix or with the prefix declared in the written document: xml, epub and,
+// in SVG elements, xlink.
+func isXMLAttr(name string, svg bool) bool {
+	prefix, local, ok := strings.Cut(name, ":")
+	switch {
+	case !ok:
+		return isXMLName(name)
+	case prefix == "xml" || prefix == "epub" || prefix == "xlink" && svg:
+		return isXMLName(local)
+	default:
+		return false
+	}
+}
+
+// isXMLName returns true if the name is a valid XML name without prefix.
+func isXMLName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_', r > 0x7f:
+		case i > 0 && (r >= '0' && r <= '9' || r == '-' || r == '.'):
+		default:
+			return false
+		}
+	}
+	return true
+}
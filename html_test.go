@@ -0,0 +1,87 @@
+package epub_test
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+
+	epub "github.com/mdigger/epub3"
+)
+
+func TestHTMLToXHTMLAttrPrefixes(t *testing.T) {
+	const src = `<!DOCTYPE html><html lang="en"><head><title>Test</title></head>
+<body><section epub:type="chapter" foo:bar="1" xml:space="preserve">
+<p xlink:href="a.xhtml" data-x="2">Text</p>
+<svg><a xlink:href="b.xhtml" foo:baz="3"><text>Link</text></a></svg>
+</section></body></html>`
+	var buf bytes.Buffer
+	if err := epub.HTMLToXHTML(&buf, strings.NewReader(src)); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{`epub:type="chapter"`, `xml:space="preserve"`,
+		`data-x="2"`, `<a xlink:href="b.xhtml">`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output does not contain %s:\n%s", want, out)
+		}
+	}
+	for _, bad := range []string{"foo:", `<p xlink:href`} {
+		if strings.Contains(out, bad) {
+			t.Errorf("output contains %s:\n%s", bad, out)
+		}
+	}
+
+	// all prefixes must be declared
+	dec := xml.NewDecoder(&buf)
+	for {
+		token, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			for _, attr := range start.Attr {
+				if attr.Name.Space != "" && !strings.Contains(attr.Name.Space, "/") &&
+					attr.Name.Space != "xmlns" {
+					t.Errorf("undeclared prefix %q of the attribute %s", attr.Name.Space, attr.Name.Local)
+				}
+			}
+		}
+	}
+}
+
+func TestHTMLToXHTMLInvalidXML(t *testing.T) {
+	const src = "<!DOCTYPE html><html><head><title>Test</title></head>\n" +
+		"<body><my:tag class=\"x\"><p>Inside\x01</p></my:tag>" +
+		"<p title=\"a\x02b\">Text\x0b\tend</p><!-- note\x03 --></body></html>"
+	var buf bytes.Buffer
+	if err := epub.HTMLToXHTML(&buf, strings.NewReader(src)); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{"<p>Inside</p>", `<p title="ab">Text` + "\tend</p>",
+		"<!-- note -->"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output does not contain %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "my:tag") {
+		t.Errorf("output contains element with undeclared prefix:\n%s", out)
+	}
+
+	// the output is well-formed XML
+	dec := xml.NewDecoder(&buf)
+	for {
+		_, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package epub
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/mdigger/epub3/internal/ocf"
+)
+
+// Index is the registry of index terms and references to their locations in
+// the publication content. It is used to generate the back-of-book index.
+type Index struct {
+	Title   string // Title of the index. “Index” is used if not defined.
+	entries indexEntries
+}
+
+// indexEntries is the list of index entries by term.
+type indexEntries map[string]*indexEntry
+
+// indexEntry describes the index term with locators and subentries.
+type indexEntry struct {
+	locators []string
+	entries  indexEntries
+}
+
+// Add registers the location of the index term. The href is the name of the
+// content document with the fragment identifier of the term occurrence. If
+// several terms are defined, the following terms are subentries of the first
+// one: idx.Add("ch01.xhtml#p12", "fruit", "apple").
+func (idx *Index) Add(href string, terms ...string) {
+	if len(terms) == 0 {
+		return
+	}
+	if idx.entries == nil {
+		idx.entries = make(indexEntries)
+	}
+	entries := idx.entries
+	var entry *indexEntry
+	for _, term := range terms {
+		entry = entries[term]
+		if entry == nil {
+			entry = &indexEntry{entries: make(indexEntries)}
+			entries[term] = entry
+		}
+		entries = entry.entries
+	}
+	entry.locators = append(entry.locators, filepath.ToSlash(href))
+}
+
+// sorted returns the sorted list of the index terms.
+func (e indexEntries) sorted() []string {
+	terms := make([]string, 0, len(e))
+	for term := range e {
+		terms = append(terms, term)
+	}
+	sort.Slice(terms, func(i, j int) bool {
+		a, b := strings.ToLower(terms[i]), strings.ToLower(terms[j])
+		if a == b {
+			return terms[i] < terms[j]
+		}
+		return a < b
+	})
+	return terms
+}
+
+// AddIndex generates the index document with the given name from the index
+// terms and adds it to the publication, to the index collection and to the
+// landmarks of the navigation document.
+func (r *Rendition) AddIndex(name string, idx *Index) error {
+	name = filepath.ToSlash(name) // normalize file name
+	title := idx.Title
+	if title == "" {
+		title = "Index"
+	}
+
+	html, body := newDocument(title, r.Lang())
+	section := newElement("section", "epub:type", "index")
+	section.add(newElement("h1").add(title))
+	// group entries by first letter
+	var (
+		group  *element
+		letter string
+	)
+	for _, term := range idx.entries.sorted() {
+		c, _ := utf8.DecodeRuneInString(term)
+		first := string(unicode.ToUpper(c))
+		if group == nil || first != letter {
+			letter = first
+			group = newElement("ul", "epub:type", "index-entry-list")
+			section.add(newElement("section", "epub:type", "index-group").add(
+				newElement("h2").add(letter),
+				group,
+			))
+		}
+		group.add(indexItem(name, term, idx.entries[term]))
+	}
+	body.add(section)
+
+	var buf bytes.Buffer
+	if err := encodeXML(&buf, "html", html); err != nil {
+		return err
+	}
+	if err := r.addContent(context.Background(), &buf, name, "application/xhtml+xml", Primary,
+		[]string{"index"}); err != nil {
+		return err
+	}
+	r.AddCollection(CollectionIndex).AddLinks(name)
+	r.AddLandmark("index", title, name)
+	return nil
+}
+
+// indexItem returns the list item of the index document for the term.
+func indexItem(name, term string, entry *indexEntry) *element {
+	item := newElement("li", "epub:type", "index-entry").add(
+		newElement("span", "epub:type", "index-term").add(term))
+	for i, href := range entry.locators {
+		item.add(", ", newElement("a",
+			"epub:type", "index-locator",
+			"href", ocf.Relative(name, href),
+		).add(strconv.Itoa(i+1)))
+	}
+	if len(entry.entries) > 0 {
+		list := newElement("ul", "epub:type", "index-entry-list")
+		for _, subterm := range entry.entries.sorted() {
+			list.add(indexItem(name, subterm, entry.entries[subterm]))
+		}
+		item.add(list)
+	}
+	return item
+}
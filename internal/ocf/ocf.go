@@ -0,0 +1,40 @@
+// Package ocf contains helpers for the names of files in the publication
+// container (EPUB Open Container Format) shared by the epub packages.
+package ocf
+
+import (
+	"net/url"
+	"path"
+	"strings"
+)
+
+// Resolve returns the name of the file in the container referenced from the
+// folder. Returns false if the reference is not local or refers to the same
+// document.
+func Resolve(dir, href string) (string, bool) {
+	ref, err := url.Parse(href)
+	if err != nil || ref.Scheme != "" || ref.Host != "" || ref.Path == "" {
+		return "", false
+	}
+	if strings.HasPrefix(ref.Path, "/") {
+		return strings.TrimPrefix(path.Clean(ref.Path), "/"), true
+	}
+	return path.Join(dir, ref.Path), true
+}
+
+// Relative returns the reference to the target file relative to the folder of
+// the source file. Both names are relative to the same root folder.
+func Relative(source, target string) string {
+	dir := path.Dir(source)
+	if dir == "." {
+		return target
+	}
+	dirs := strings.Split(dir, "/")
+	parts := strings.Split(target, "/")
+	// skip the common part of the path
+	var i int
+	for i < len(dirs) && i < len(parts)-1 && dirs[i] == parts[i] {
+		i++
+	}
+	return strings.Repeat("../", len(dirs)-i) + strings.Join(parts[i:], "/")
+}
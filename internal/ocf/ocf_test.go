@@ -0,0 +1,46 @@
+package ocf
+
+import "testing"
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		dir, href string
+		name      string
+		ok        bool
+	}{
+		{"OEBPS", "text/chapter.xhtml", "OEBPS/text/chapter.xhtml", true},
+		{"OEBPS/text", "../images/cover.png#frag", "OEBPS/images/cover.png", true},
+		{"OEBPS", "my%20file.xhtml", "OEBPS/my file.xhtml", true},
+		{"OEBPS", "/images/../cover.png", "cover.png", true},
+		{".", "chapter.xhtml", "chapter.xhtml", true},
+		{"OEBPS", "#note", "", false},
+		{"OEBPS", "https://example.com/style.css", "", false},
+		{"OEBPS", "mailto:author@example.com", "", false},
+		{"OEBPS", "//example.com/style.css", "", false},
+	}
+	for _, test := range tests {
+		name, ok := Resolve(test.dir, test.href)
+		if name != test.name || ok != test.ok {
+			t.Errorf("Resolve(%q, %q) = %q, %v; want %q, %v",
+				test.dir, test.href, name, ok, test.name, test.ok)
+		}
+	}
+}
+
+func TestRelative(t *testing.T) {
+	tests := []struct {
+		source, target string
+		href           string
+	}{
+		{"nav.xhtml", "text/chapter.xhtml", "text/chapter.xhtml"},
+		{"text/chapter.xhtml", "style.css", "../style.css"},
+		{"text/chapter.xhtml", "text/notes.xhtml", "notes.xhtml"},
+		{"text/part/chapter.xhtml", "text/images/cover.png", "../images/cover.png"},
+		{"a/b/c.xhtml", "d/e.css", "../../d/e.css"},
+	}
+	for _, test := range tests {
+		if href := Relative(test.source, test.target); href != test.href {
+			t.Errorf("Relative(%q, %q) = %q, want %q", test.source, test.target, href, test.href)
+		}
+	}
+}
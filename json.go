@@ -0,0 +1,531 @@
+package epub
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// jsonMeta is the JSON representation of the meta element. The meta elements
+// refining the element are folded into its refinements.
+type jsonMeta struct {
+	Property    string      `json:"property"`
+	Value       string      `json:"value"`
+	ID          string      `json:"id,omitempty"`
+	Scheme      string      `json:"scheme,omitempty"`
+	Lang        string      `json:"lang,omitempty"`
+	Dir         string      `json:"dir,omitempty"`
+	Refines     string      `json:"refines,omitempty"` // only for elements outside of the document
+	Name        string      `json:"name,omitempty"`    // EPUB 2 meta element
+	Content     string      `json:"content,omitempty"` // EPUB 2 meta element
+	Refinements []*jsonMeta `json:"refinements,omitempty"`
+}
+
+// jsonElement is the JSON representation of the DCMES element.
+type jsonElement struct {
+	Value       string      `json:"value"`
+	ID          string      `json:"id,omitempty"`
+	Lang        string      `json:"lang,omitempty"`
+	Dir         string      `json:"dir,omitempty"`
+	Scheme      string      `json:"scheme,omitempty"`  // EPUB 2 opf:scheme attribute
+	Event       string      `json:"event,omitempty"`   // EPUB 2 opf:event attribute
+	Role        string      `json:"role,omitempty"`    // EPUB 2 opf:role attribute
+	FileAs      string      `json:"file-as,omitempty"` // EPUB 2 opf:file-as attribute
+	Refinements []*jsonMeta `json:"refinements,omitempty"`
+}
+
+// jsonLink is the JSON representation of the metadata link element.
+type jsonLink struct {
+	Link
+	Refinements []*jsonMeta `json:"refinements,omitempty"`
+}
+
+// jsonMetadata is the JSON representation of the publication metadata.
+type jsonMetadata struct {
+	Identifiers  []*jsonElement `json:"identifiers,omitempty"`
+	Titles       []*jsonElement `json:"titles,omitempty"`
+	Languages    []*jsonElement `json:"languages,omitempty"`
+	Date         *jsonElement   `json:"date,omitempty"`
+	Creators     []*jsonElement `json:"creators,omitempty"`
+	Contributors []*jsonElement `json:"contributors,omitempty"`
+	Subjects     []*jsonElement `json:"subjects,omitempty"`
+	Descriptions []*jsonElement `json:"descriptions,omitempty"`
+	Types        []*jsonElement `json:"types,omitempty"`
+	Formats      []*jsonElement `json:"formats,omitempty"`
+	Publishers   []*jsonElement `json:"publishers,omitempty"`
+	Sources      []*jsonElement `json:"sources,omitempty"`
+	Relations    []*jsonElement `json:"relations,omitempty"`
+	Coverages    []*jsonElement `json:"coverages,omitempty"`
+	Rights       []*jsonElement `json:"rights,omitempty"`
+	Meta         []*jsonMeta    `json:"meta,omitempty"`
+	Links        []*jsonLink    `json:"links,omitempty"`
+}
+
+// refinements folds the meta elements into the entries they refine.
+type refinements struct {
+	meta       []Meta
+	refines    map[string][]int // indexes of meta elements by refined ID
+	refinement []bool           // meta elements refining the known entries
+	folded     []bool           // meta elements already converted
+}
+
+// newRefinements returns refinements of the meta elements. The meta element
+// is folded if it refines one of the targets.
+func newRefinements(meta []Meta, targets map[string]bool) *refinements {
+	r := &refinements{
+		meta:       meta,
+		refines:    make(map[string][]int),
+		refinement: make([]bool, len(meta)),
+		folded:     make([]bool, len(meta)),
+	}
+	for i, item := range meta {
+		if id := strings.TrimPrefix(item.Refines, "#"); id != item.Refines && targets[id] {
+			r.refines[id] = append(r.refines[id], i)
+			r.refinement[i] = true
+		}
+	}
+	return r
+}
+
+// convert returns the JSON representation of the meta element with the
+// refinements.
+func (r *refinements) convert(i int) *jsonMeta {
+	r.folded[i] = true
+	item := r.meta[i]
+	meta := &jsonMeta{
+		Property: item.Property,
+		Value:    item.Value,
+		ID:       item.ID,
+		Scheme:   item.Scheme,
+		Lang:     item.Lang,
+		Dir:      item.Dir,
+		Name:     item.Name,
+		Content:  item.Content,
+	}
+	if !r.refinement[i] {
+		meta.Refines = item.Refines
+	}
+	meta.Refinements = r.list(item.ID)
+	return meta
+}
+
+// list returns the refinements of the entry with the given ID.
+func (r *refinements) list(id string) []*jsonMeta {
+	if id == "" {
+		return nil
+	}
+	var list []*jsonMeta
+	for _, i := range r.refines[id] {
+		if !r.folded[i] { // skip circular refinements
+			list = append(list, r.convert(i))
+		}
+	}
+	return list
+}
+
+// rest returns the meta elements that are not folded into other entries.
+func (r *refinements) rest() []*jsonMeta {
+	var list []*jsonMeta
+	for i := range r.meta {
+		if !r.folded[i] && !r.refinement[i] {
+			list = append(list, r.convert(i))
+		}
+	}
+	// circular refinements are not reachable from other entries
+	for i := range r.meta {
+		if !r.folded[i] {
+			meta := r.convert(i)
+			meta.Refines = r.meta[i].Refines
+			list = append(list, meta)
+		}
+	}
+	return list
+}
+
+// elements returns the JSON representation of the elements.
+func (r *refinements) elements(list []ElementLang) []*jsonElement {
+	if len(list) == 0 {
+		return nil
+	}
+	result := make([]*jsonElement, len(list))
+	for i, item := range list {
+		result[i] = &jsonElement{Value: item.Value, ID: item.ID, Lang: item.Lang, Dir: item.Dir,
+			Role: item.Role, FileAs: item.FileAs, Refinements: r.list(item.ID)}
+	}
+	return result
+}
+
+// simpleElements returns the JSON representation of the elements without
+// language.
+func (r *refinements) simpleElements(list []Element) []*jsonElement {
+	if len(list) == 0 {
+		return nil
+	}
+	result := make([]*jsonElement, len(list))
+	for i, item := range list {
+		result[i] = &jsonElement{Value: item.Value, ID: item.ID, Scheme: item.Scheme,
+			Event: item.Event, Refinements: r.list(item.ID)}
+	}
+	return result
+}
+
+// ids returns the identifiers of the metadata entries.
+func (m *Metadata) ids() map[string]bool {
+	ids := make(map[string]bool)
+	for _, list := range [][]Element{m.Identifier, m.Language, m.Type, m.Format, m.Source} {
+		for _, item := range list {
+			ids[item.ID] = true
+		}
+	}
+	if m.Date != nil {
+		ids[m.Date.ID] = true
+	}
+	for _, list := range [][]ElementLang{m.Title, m.Creator, m.Contributor, m.Subject,
+		m.Description, m.Publisher, m.Relation, m.Coverage, m.Rights} {
+		for _, item := range list {
+			ids[item.ID] = true
+		}
+	}
+	for _, item := range m.Meta {
+		ids[item.ID] = true
+	}
+	for _, item := range m.Link {
+		ids[item.ID] = true
+	}
+	delete(ids, "")
+	return ids
+}
+
+// hasEPUB2Attrs returns true if the metadata elements have the EPUB 2
+// attributes with the opf prefix.
+func (m *Metadata) hasEPUB2Attrs() bool {
+	for _, list := range [][]Element{m.Identifier, m.Language, m.Type, m.Format, m.Source} {
+		for _, item := range list {
+			if item.Scheme != "" || item.Event != "" {
+				return true
+			}
+		}
+	}
+	if m.Date != nil && (m.Date.Scheme != "" || m.Date.Event != "") {
+		return true
+	}
+	for _, list := range [][]ElementLang{m.Creator, m.Contributor} {
+		for _, item := range list {
+			if item.Role != "" || item.FileAs != "" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// MarshalJSON implements json.Marshaler interface. The meta elements refining
+// other metadata entries are folded into their refinements.
+func (m Metadata) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.toJSON(newRefinements(m.Meta, m.ids())))
+}
+
+// toJSON returns the JSON representation of the metadata with the given
+// refinements.
+func (m *Metadata) toJSON(r *refinements) *jsonMetadata {
+	data := &jsonMetadata{
+		Identifiers:  r.simpleElements(m.Identifier),
+		Titles:       r.elements(m.Title),
+		Languages:    r.simpleElements(m.Language),
+		Creators:     r.elements(m.Creator),
+		Contributors: r.elements(m.Contributor),
+		Subjects:     r.elements(m.Subject),
+		Descriptions: r.elements(m.Description),
+		Types:        r.simpleElements(m.Type),
+		Formats:      r.simpleElements(m.Format),
+		Publishers:   r.elements(m.Publisher),
+		Sources:      r.simpleElements(m.Source),
+		Relations:    r.elements(m.Relation),
+		Coverages:    r.elements(m.Coverage),
+		Rights:       r.elements(m.Rights),
+	}
+	if m.Date != nil {
+		data.Date = r.simpleElements([]Element{*m.Date})[0]
+	}
+	for _, item := range m.Link {
+		data.Links = append(data.Links, &jsonLink{Link: item, Refinements: r.list(item.ID)})
+	}
+	data.Meta = r.rest()
+	return data
+}
+
+// unfolder converts the refinements of JSON entries to meta elements.
+type unfolder struct {
+	used map[string]bool // identifiers of entries
+	meta []Meta          // converted meta elements
+}
+
+// newUnfolder returns the unfolder for the metadata.
+func newUnfolder(data *jsonMetadata) *unfolder {
+	u := &unfolder{used: make(map[string]bool)}
+	var collect func(list []*jsonMeta)
+	collect = func(list []*jsonMeta) {
+		for _, item := range list {
+			u.used[item.ID] = true
+			collect(item.Refinements)
+		}
+	}
+	for _, list := range data.elementLists() {
+		for _, item := range list {
+			u.used[item.ID] = true
+			collect(item.Refinements)
+		}
+	}
+	for _, item := range data.Links {
+		u.used[item.ID] = true
+		collect(item.Refinements)
+	}
+	collect(data.Meta)
+	return u
+}
+
+// reserve marks the identifiers of other elements as used.
+func (u *unfolder) reserve(ids ...string) {
+	for _, id := range ids {
+		u.used[id] = true
+	}
+}
+
+// reserveCollections marks the identifiers of the collections, their
+// metadata entries and links as used.
+func (u *unfolder) reserveCollections(list []*Collection) {
+	for _, collection := range list {
+		u.reserve(collection.ID)
+		if collection.Metadata != nil {
+			for id := range collection.Metadata.ids() {
+				u.reserve(id)
+			}
+		}
+		for _, link := range collection.Links {
+			u.reserve(link.ID)
+		}
+		u.reserveCollections(collection.Collections)
+	}
+}
+
+// id returns the identifier of the entry. The unique identifier is generated
+// if the entry has refinements without identifier.
+func (u *unfolder) id(id, prefix string, refinements []*jsonMeta) string {
+	if id != "" || len(refinements) == 0 {
+		return id
+	}
+	for n := 1; ; n++ {
+		id = fmt.Sprintf("%s%02d", prefix, n)
+		if !u.used[id] {
+			u.used[id] = true
+			return id
+		}
+	}
+}
+
+// add converts the refinements of the entry with the given ID.
+func (u *unfolder) add(id string, list []*jsonMeta) {
+	for _, item := range list {
+		refines := item.Refines
+		if id != "" {
+			refines = "#" + id
+		}
+		itemID := u.id(item.ID, "meta", item.Refinements)
+		u.meta = append(u.meta, Meta{
+			Refines:  refines,
+			Property: item.Property,
+			Scheme:   item.Scheme,
+			ID:       itemID,
+			Dir:      item.Dir,
+			Lang:     item.Lang,
+			Value:    item.Value,
+			Name:     item.Name,
+			Content:  item.Content,
+		})
+		u.add(itemID, item.Refinements)
+	}
+}
+
+// elements returns the elements with language converted from JSON.
+func (u *unfolder) elements(prefix string, list []*jsonElement) []ElementLang {
+	if len(list) == 0 {
+		return nil
+	}
+	result := make([]ElementLang, len(list))
+	for i, item := range list {
+		id := u.id(item.ID, prefix, item.Refinements)
+		result[i] = ElementLang{Value: item.Value, ID: id, Dir: item.Dir, Lang: item.Lang,
+			Role: item.Role, FileAs: item.FileAs}
+		u.add(id, item.Refinements)
+	}
+	return result
+}
+
+// simpleElements returns the elements without language converted from JSON.
+func (u *unfolder) simpleElements(prefix string, list []*jsonElement) []Element {
+	if len(list) == 0 {
+		return nil
+	}
+	result := make([]Element, len(list))
+	for i, item := range list {
+		id := u.id(item.ID, prefix, item.Refinements)
+		result[i] = Element{Value: item.Value, ID: id, Scheme: item.Scheme, Event: item.Event}
+		u.add(id, item.Refinements)
+	}
+	return result
+}
+
+// elementLists returns all lists of the DCMES elements.
+func (data *jsonMetadata) elementLists() [][]*jsonElement {
+	lists := [][]*jsonElement{data.Identifiers, data.Titles, data.Languages,
+		data.Creators, data.Contributors, data.Subjects, data.Descriptions, data.Types,
+		data.Formats, data.Publishers, data.Sources, data.Relations, data.Coverages,
+		data.Rights}
+	if data.Date != nil {
+		lists = append(lists, []*jsonElement{data.Date})
+	}
+	return lists
+}
+
+// toMetadata returns the metadata converted from JSON.
+func (data *jsonMetadata) toMetadata(u *unfolder) Metadata {
+	m := Metadata{
+		Identifier:  u.simpleElements("identifier", data.Identifiers),
+		Title:       u.elements("title", data.Titles),
+		Language:    u.simpleElements("language", data.Languages),
+		Creator:     u.elements("creator", data.Creators),
+		Contributor: u.elements("contributor", data.Contributors),
+		Subject:     u.elements("subject", data.Subjects),
+		Description: u.elements("description", data.Descriptions),
+		Type:        u.simpleElements("type", data.Types),
+		Format:      u.simpleElements("format", data.Formats),
+		Publisher:   u.elements("publisher", data.Publishers),
+		Source:      u.simpleElements("source", data.Sources),
+		Relation:    u.elements("relation", data.Relations),
+		Coverage:    u.elements("coverage", data.Coverages),
+		Rights:      u.elements("rights", data.Rights),
+	}
+	if data.Date != nil {
+		m.Date = &u.simpleElements("date", []*jsonElement{data.Date})[0]
+	}
+	u.add("", data.Meta)
+	for _, item := range data.Links {
+		link := item.Link
+		link.ID = u.id(link.ID, "link", item.Refinements)
+		m.Link = append(m.Link, link)
+		u.add(link.ID, item.Refinements)
+	}
+	m.Meta = u.meta
+	return m
+}
+
+// UnmarshalJSON implements json.Unmarshaler interface. The refinements of
+// metadata entries are converted to meta elements; identifiers are generated
+// for entries with refinements if they are not defined.
+func (m *Metadata) UnmarshalJSON(data []byte) error {
+	var value jsonMetadata
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	*m = value.toMetadata(newUnfolder(&value))
+	return nil
+}
+
+// jsonItem is the JSON representation of the manifest item.
+type jsonItem struct {
+	Item
+	Refinements []*jsonMeta `json:"refinements,omitempty"`
+}
+
+// jsonPackage is the JSON representation of the package document.
+type jsonPackage struct {
+	Version          string        `json:"version"`
+	UniqueIdentifier string        `json:"unique-identifier"`
+	Prefix           string        `json:"prefix,omitempty"`
+	Lang             string        `json:"lang,omitempty"`
+	Dir              string        `json:"dir,omitempty"`
+	ID               string        `json:"id,omitempty"`
+	Metadata         *jsonMetadata `json:"metadata"`
+	Manifest         struct {
+		ID    string      `json:"id,omitempty"`
+		Items []*jsonItem `json:"items"`
+	} `json:"manifest"`
+	Spine       Spine         `json:"spine"`
+	Guide       *Guide        `json:"guide,omitempty"`
+	Collections []*Collection `json:"collections,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler interface. The meta elements refining
+// metadata entries or manifest items are folded into their refinements.
+func (p Package) MarshalJSON() ([]byte, error) {
+	targets := p.Metadata.ids()
+	for _, item := range p.Manifest.Items {
+		targets[item.ID] = true
+	}
+	r := newRefinements(p.Metadata.Meta, targets)
+	data := jsonPackage{
+		Version:          p.Version,
+		UniqueIdentifier: p.UniqueIdentifier,
+		Prefix:           p.Prefix,
+		Lang:             p.Lang,
+		Dir:              p.Dir,
+		ID:               p.ID,
+		Spine:            p.Spine,
+		Guide:            p.Guide,
+		Collections:      p.Collections,
+	}
+	data.Manifest.ID = p.Manifest.ID
+	data.Manifest.Items = make([]*jsonItem, len(p.Manifest.Items))
+	for i, item := range p.Manifest.Items {
+		data.Manifest.Items[i] = &jsonItem{Item: item, Refinements: r.list(item.ID)}
+	}
+	data.Metadata = p.Metadata.toJSON(r)
+	return json.Marshal(data)
+}
+
+// UnmarshalJSON implements json.Unmarshaler interface. The refinements of
+// metadata entries and manifest items are converted to meta elements.
+func (p *Package) UnmarshalJSON(data []byte) error {
+	var value jsonPackage
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	if value.Metadata == nil {
+		value.Metadata = new(jsonMetadata)
+	}
+	u := newUnfolder(value.Metadata)
+	// the generated identifiers must not conflict with other package elements
+	u.reserve(value.ID, value.Manifest.ID, value.Spine.ID)
+	for _, item := range value.Manifest.Items {
+		u.reserve(item.ID)
+	}
+	for _, item := range value.Spine.ItemRefs {
+		u.reserve(item.ID)
+	}
+	u.reserveCollections(value.Collections)
+	*p = Package{
+		Version:          value.Version,
+		UniqueIdentifier: value.UniqueIdentifier,
+		Prefix:           value.Prefix,
+		Lang:             value.Lang,
+		Dir:              value.Dir,
+		ID:               value.ID,
+		Metadata:         value.Metadata.toMetadata(u),
+		Spine:            value.Spine,
+		Guide:            value.Guide,
+		Collections:      value.Collections,
+	}
+	p.Metadata.DC = nsDC // required to serialize the package as XML
+	if p.Metadata.hasEPUB2Attrs() {
+		p.Metadata.OPF = nsOPF
+	}
+	p.Manifest.ID = value.Manifest.ID
+	p.Manifest.Items = make([]Item, len(value.Manifest.Items))
+	u.meta = nil
+	for i, item := range value.Manifest.Items {
+		p.Manifest.Items[i] = item.Item
+		u.add(item.ID, item.Refinements)
+	}
+	p.Metadata.Meta = append(p.Metadata.Meta, u.meta...)
+	return nil
+}
@@ -0,0 +1,229 @@
+package epub_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	epub "github.com/mdigger/epub3"
+)
+
+const testJSONPackage = `<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="pub-id" xml:lang="en">
+<metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+<dc:identifier id="pub-id">urn:isbn:9780000000000</dc:identifier>
+<dc:title id="title">Title</dc:title>
+<dc:language>en</dc:language>
+<dc:creator id="creator01">John Smith</dc:creator>
+<meta refines="#title" property="title-type">main</meta>
+<meta refines="#creator01" property="role" scheme="marc:relators" id="role">aut</meta>
+<meta refines="#role" property="alternate-script" xml:lang="ru">автор</meta>
+<meta refines="#creator01" property="file-as">Smith, John</meta>
+<meta property="belongs-to-collection" id="series">Series</meta>
+<meta refines="#series" property="collection-type">series</meta>
+<meta refines="#cover" property="dcterms:description">Cover</meta>
+<meta refines="#outside" property="role">ill</meta>
+<meta property="dcterms:modified">2020-01-02T03:04:05Z</meta>
+</metadata>
+<manifest>
+<item id="cover" href="cover.jpg" media-type="image/jpeg" properties="cover-image"/>
+<item id="text" href="text.xhtml" media-type="application/xhtml+xml"/>
+</manifest>
+<spine><itemref idref="text"/></spine>
+</package>`
+
+// refinedValues returns the values of the meta elements mapped to the value
+// of the refined element (or the refines attribute if it is not found) and the
+// property.
+func refinedValues(pkg *epub.Package) map[string]string {
+	values := make(map[string]string)
+	targets := make(map[string]string)
+	for _, list := range [][]epub.ElementLang{pkg.Metadata.Title, pkg.Metadata.Creator} {
+		for _, item := range list {
+			targets[item.ID] = item.Value
+		}
+	}
+	for _, item := range pkg.Manifest.Items {
+		targets[item.ID] = item.Href
+	}
+	for _, meta := range pkg.Metadata.Meta {
+		if meta.ID != "" {
+			targets[meta.ID] = meta.Value
+		}
+	}
+	for _, meta := range pkg.Metadata.Meta {
+		target := meta.Refines
+		if value, ok := targets[strings.TrimPrefix(target, "#")]; ok {
+			target = value
+		}
+		values[target+" "+meta.Property] = meta.Value + " " + meta.Scheme + " " + meta.Lang
+	}
+	return values
+}
+
+func TestPackageJSON(t *testing.T) {
+	pkg, err := epub.ReadPackage(strings.NewReader(testJSONPackage))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(pkg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), `"refines":"#creator01"`) {
+		t.Errorf("refinements are not folded: %s", data)
+	}
+	var decoded epub.Package
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	// the second conversion returns the same JSON
+	again, err := json.Marshal(&decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, again) {
+		t.Errorf("JSON is changed:\n%s\n%s", data, again)
+	}
+
+	// the refinements refer to the same elements
+	want, got := refinedValues(pkg), refinedValues(&decoded)
+	if len(got) != len(want) {
+		t.Errorf("refinements = %v, want %v", got, want)
+	}
+	for key, value := range want {
+		if got[key] != value {
+			t.Errorf("refinement %q = %q, want %q", key, got[key], value)
+		}
+	}
+
+	// the decoded package is written as XML and read again
+	out, err := xml.Marshal(&decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reread, err := epub.ReadPackage(bytes.NewReader(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := refinedValues(reread); len(got) != len(want) {
+		t.Errorf("refinements after XML round-trip = %v, want %v", got, want)
+	}
+	if reread.UniqueIdentifier != "pub-id" || len(reread.Manifest.Items) != 2 ||
+		len(reread.Spine.ItemRefs) != 1 {
+		t.Errorf("package after XML round-trip: %s", out)
+	}
+}
+
+func TestPackageJSONGeneratedIDs(t *testing.T) {
+	const data = `{
+	"version": "3.0",
+	"unique-identifier": "pub-id",
+	"metadata": {
+		"identifiers": [{"value": "urn:uuid:1", "id": "pub-id"}],
+		"creators": [{"value": "Author", "refinements": [
+			{"property": "role", "value": "aut", "refinements": [
+				{"property": "alternate-script", "value": "автор"}]}]}]
+	},
+	"manifest": {"items": [
+		{"id": "creator01", "href": "text.xhtml", "media-type": "application/xhtml+xml"},
+		{"id": "meta01", "href": "cover.jpg", "media-type": "image/jpeg"}
+	]},
+	"spine": {"itemrefs": [{"idref": "creator01", "id": "creator02"}]}
+}`
+	var pkg epub.Package
+	if err := json.Unmarshal([]byte(data), &pkg); err != nil {
+		t.Fatal(err)
+	}
+	ids := map[string]bool{"pub-id": true, "creator01": true, "meta01": true, "creator02": true}
+	creator := pkg.Metadata.Creator[0].ID
+	if ids[creator] || creator == "" {
+		t.Errorf("creator ID %q conflicts with other elements", creator)
+	}
+	ids[creator] = true
+	for _, meta := range pkg.Metadata.Meta {
+		if meta.ID != "" {
+			if ids[meta.ID] {
+				t.Errorf("meta ID %q conflicts with other elements", meta.ID)
+			}
+			ids[meta.ID] = true
+		}
+	}
+	if values := refinedValues(&pkg); values["Author role"] != "aut  " {
+		t.Errorf("refinements = %v", values)
+	}
+}
+
+func TestPackageJSONEPUB2(t *testing.T) {
+	const opf = `<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="2.0" unique-identifier="bookid">
+<metadata xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:opf="http://www.idpf.org/2007/opf">
+<dc:identifier id="bookid" opf:scheme="ISBN">9780000000000</dc:identifier>
+<dc:title>Old Book</dc:title>
+<dc:language>en</dc:language>
+<dc:creator opf:role="aut" opf:file-as="Smith, John">John Smith</dc:creator>
+<dc:date opf:event="publication">2001</dc:date>
+<meta name="cover" content="cover"/>
+</metadata>
+<manifest>
+<item id="ncx" href="toc.ncx" media-type="application/x-dtbncx+xml"/>
+<item id="cover" href="cover.jpg" media-type="image/jpeg"/>
+<item id="text" href="text.xhtml" media-type="application/xhtml+xml"/>
+</manifest>
+<spine toc="ncx"><itemref idref="text"/></spine>
+<guide><reference type="text" title="Start" href="text.xhtml"/></guide>
+</package>`
+	pkg, err := epub.ReadPackage(strings.NewReader(opf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(pkg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded epub.Package
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	again, err := json.Marshal(&decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, again) {
+		t.Errorf("JSON is changed:\n%s\n%s", data, again)
+	}
+
+	// the decoded package is written as XML and read again
+	out, err := xml.Marshal(&decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reread, err := epub.ReadPackage(bytes.NewReader(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := reread.Metadata
+	if id := m.Identifier[0]; id.Scheme != "ISBN" {
+		t.Errorf("identifier scheme = %q, want ISBN", id.Scheme)
+	}
+	if creator := m.Creator[0]; creator.Role != "aut" || creator.FileAs != "Smith, John" {
+		t.Errorf("creator role %q, file-as %q", creator.Role, creator.FileAs)
+	}
+	if m.Date == nil || m.Date.Event != "publication" {
+		t.Errorf("date = %+v", m.Date)
+	}
+	if len(m.Meta) != 1 || m.Meta[0].Name != "cover" || m.Meta[0].Content != "cover" {
+		t.Errorf("meta = %+v", m.Meta)
+	}
+	if reread.Spine.Toc != "ncx" {
+		t.Errorf("spine toc = %q, want ncx", reread.Spine.Toc)
+	}
+	if g := reread.Guide; g == nil || len(g.References) != 1 ||
+		g.References[0].Type != "text" || g.References[0].Title != "Start" ||
+		g.References[0].Href != "text.xhtml" {
+		t.Errorf("guide = %+v", g)
+	}
+}
@@ -0,0 +1,138 @@
+package markdown_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"html/template"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+
+	epub "github.com/mdigger/epub3"
+	"github.com/mdigger/epub3/markdown"
+)
+
+// readFile returns the content of the file from the publication archive.
+func readFile(t *testing.T, data []byte, name string) string {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := zr.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	content, err := io.ReadAll(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+func TestConvert(t *testing.T) {
+	const source = `# Chapter
+
+Copyright &copy; 2020,&nbsp;Author&hellip; &amp; &unknown; ` + "`&lt;code&gt;`" + `
+
+## Table
+
+| Name | Value |
+|------|------:|
+| one  | 1     |
+
+## Notes
+
+Text with the note.[^1]
+
+[^1]: The note.
+
+### Terms
+
+Term
+:   Definition of the term.
+`
+	tmpl := template.Must(template.New("chapter").Parse(templateSource))
+	var buf bytes.Buffer
+	pub, err := epub.New(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub.AddTitle("Test")
+	b, err := markdown.NewBuilder(pub.Rendition, markdown.WithTemplate(tmpl),
+		markdown.WithStylesheet("style.css", []byte("p {}")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Add("text/chapter.md", []byte(source)); err != nil {
+		t.Fatal(err)
+	}
+	if err := pub.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	content := readFile(t, buf.Bytes(), "OEBPS/text/chapter.xhtml")
+	for _, want := range []string{
+		`<link rel="stylesheet" type="text/css" href="../style.css"/>`,
+		"<p>Copyright © 2020, Author… &amp; &amp;unknown;",
+		"<footer>&#169;&#160;Author</footer>",
+		`<th align="right">Value</th>`,
+		`<td>one</td>`,
+		`<a href="#fn:1" class="footnote-ref" role="doc-noteref">1</a>`,
+		`<li id="fn:1">`,
+		"<dt>Term</dt>\n<dd>Definition of the term.</dd>",
+	} {
+		if !strings.Contains(content, want) {
+			t.Errorf("content does not contain %s:\n%s", want, content)
+		}
+	}
+	dec := xml.NewDecoder(strings.NewReader(content))
+	for {
+		_, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("content is not well-formed: %v\n%s", err, content)
+		}
+	}
+
+	nav := readFile(t, buf.Bytes(), "OEBPS/nav.xhtml")
+	var hrefs []string
+	dec = xml.NewDecoder(strings.NewReader(nav))
+	for {
+		token, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if start, ok := token.(xml.StartElement); ok && start.Name.Local == "a" {
+			hrefs = append(hrefs, start.Attr[0].Value)
+		}
+	}
+	// the level 3 heading is not included
+	want := []string{"text/chapter.xhtml", "text/chapter.xhtml#table", "text/chapter.xhtml#notes"}
+	if !slices.Equal(hrefs, want) {
+		t.Errorf("table of contents = %q, want %q", hrefs, want)
+	}
+}
+
+// templateSource is the content document template with named references.
+const templateSource = `<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml">
+<head>
+<title>{{.Title}}</title>
+{{- with .Stylesheet}}
+<link rel="stylesheet" type="text/css" href="{{.}}"/>
+{{- end}}
+</head>
+<body>
+{{.Content}}<footer>&copy;&nbsp;Author</footer>
+</body>
+</html>
+`
@@ -0,0 +1,399 @@
+// Package markdown converts Markdown files to XHTML content documents of the
+// EPUB publication. The CommonMark syntax is extended with footnotes, tables
+// and definition lists; YAML front matter is mapped to the publication
+// metadata, and the table of contents is generated from the headings.
+package markdown
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"html/template"
+	"io/fs"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	epub "github.com/mdigger/epub3"
+	"github.com/mdigger/epub3/internal/ocf"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	htmlrenderer "github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/text"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultTemplate is the template of the content document. It is executed
+// with the Chapter data; the XML declaration is written before the template
+// output.
+var DefaultTemplate = template.Must(template.New("chapter").Parse(`<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops"
+{{- with .Lang}} xml:lang="{{.}}" lang="{{.}}"{{end}}>
+<head>
+<meta charset="utf-8"/>
+<title>{{.Title}}</title>
+{{- with .Stylesheet}}
+<link rel="stylesheet" type="text/css" href="{{.}}"/>
+{{- end}}
+</head>
+<body>
+{{.Content}}</body>
+</html>
+`))
+
+// Chapter is the data of the content document template.
+type Chapter struct {
+	Title      string        // Title of the chapter: the text of the first heading.
+	Lang       string        // Language of the publication.
+	Stylesheet string        // Reference to the style sheet relative to the document.
+	Content    template.HTML // Converted Markdown content.
+}
+
+// Option is the setting of the Builder.
+type Option func(*Builder)
+
+// WithTemplate sets the template of the content documents executed with the
+// Chapter data. The template must not contain the XML declaration; the HTML
+// named character references are replaced with the numeric ones. The
+// DefaultTemplate is used by default.
+func WithTemplate(tmpl *template.Template) Option {
+	return func(b *Builder) {
+		b.template = tmpl
+	}
+}
+
+// WithStylesheet sets the style sheet added to the publication with the given
+// name and linked from all content documents.
+func WithStylesheet(name string, css []byte) Option {
+	return func(b *Builder) {
+		b.stylesheet, b.css = path.Clean(name), css
+	}
+}
+
+// WithTOCLevel sets the maximum level of the headings included to the table
+// of contents. The default is 2.
+func WithTOCLevel(level int) Option {
+	return func(b *Builder) {
+		b.level = level
+	}
+}
+
+// Builder converts Markdown files and adds them to the publication rendition.
+type Builder struct {
+	rendition  *epub.Rendition
+	template   *template.Template
+	stylesheet string // style sheet file name
+	css        []byte // style sheet content
+	level      int    // maximum level of the table of contents
+	md         goldmark.Markdown
+}
+
+// NewBuilder returns the Builder that adds content documents to the
+// publication rendition, such as the default rendition of the Writer. The
+// style sheet, if defined, is added immediately.
+func NewBuilder(r *epub.Rendition, opts ...Option) (*Builder, error) {
+	b := &Builder{
+		rendition: r,
+		template:  DefaultTemplate,
+		level:     2,
+		md: goldmark.New(
+			goldmark.WithExtensions(
+				extension.Footnote,
+				extension.Table,
+				extension.DefinitionList,
+			),
+			goldmark.WithParserOptions(parser.WithAutoHeadingID()),
+			goldmark.WithRendererOptions(htmlrenderer.WithXHTML()),
+		),
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	if b.stylesheet != "" {
+		if err := r.AddContent(bytes.NewReader(b.css), b.stylesheet, epub.Media); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// AddFiles converts the Markdown files from the file system in the given order
+// and adds them to the publication.
+func (b *Builder) AddFiles(fsys fs.FS, names ...string) error {
+	for _, name := range names {
+		source, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		if err := b.Add(name, source); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Add converts the Markdown source and adds it to the publication as the
+// primary content document. The name of the document is the name of the
+// Markdown file with the .xhtml extension. The front matter is applied to the
+// publication metadata, and the headings are added to the table of contents.
+func (b *Builder) Add(name string, source []byte) error {
+	name = strings.TrimSuffix(path.Clean(name), path.Ext(name)) + ".xhtml"
+	front, source, err := splitFrontMatter(source)
+	if err != nil {
+		return fmt.Errorf("%s: front matter: %w", name, err)
+	}
+	if front != nil {
+		if err := front.apply(&b.rendition.Metadata); err != nil {
+			return fmt.Errorf("%s: front matter: %w", name, err)
+		}
+	}
+
+	// convert content
+	doc := b.md.Parser().Parse(text.NewReader(source))
+	var content bytes.Buffer
+	if err := b.md.Renderer().Render(&content, source, doc); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	headings := collectHeadings(doc, source)
+	chapter := Chapter{
+		Title:   strings.TrimSuffix(path.Base(name), path.Ext(name)),
+		Lang:    b.rendition.Lang(),
+		Content: template.HTML(content.String()),
+	}
+	if len(headings) > 0 {
+		chapter.Title = headings[0].title
+	}
+	if b.stylesheet != "" {
+		chapter.Stylesheet = ocf.Relative(name, b.stylesheet)
+	}
+	var document bytes.Buffer
+	if err := b.template.Execute(&document, chapter); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	if err := b.rendition.AddContent(strings.NewReader(xml.Header+numericEntities(document.String())),
+		name, epub.Primary); err != nil {
+		return err
+	}
+
+	// add table of contents entries
+	type entry struct {
+		level int
+		point *epub.NavPoint
+	}
+	var stack []entry // parent entries
+	for _, heading := range headings {
+		if heading.level > b.level {
+			continue
+		}
+		href := name
+		if !heading.first {
+			href += "#" + heading.id
+		}
+		for len(stack) > 0 && stack[len(stack)-1].level >= heading.level {
+			stack = stack[:len(stack)-1]
+		}
+		var point *epub.NavPoint
+		if len(stack) == 0 {
+			point = b.rendition.AddTOC(heading.title, href)
+		} else {
+			point = stack[len(stack)-1].point.Add(heading.title, href)
+		}
+		stack = append(stack, entry{heading.level, point})
+	}
+	if stack == nil {
+		b.rendition.AddTOC(chapter.Title, name) // no headings in the table of contents
+	}
+	return nil
+}
+
+// heading describes the heading of the Markdown document.
+type heading struct {
+	level int
+	id    string
+	title string
+	first bool // the heading starts the document
+}
+
+// collectHeadings returns the headings of the document.
+func collectHeadings(doc ast.Node, source []byte) []heading {
+	var headings []heading
+	ast.Walk(doc, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		h, ok := node.(*ast.Heading)
+		if !ok || !entering {
+			return ast.WalkContinue, nil
+		}
+		var id string
+		if value, ok := h.AttributeString("id"); ok {
+			if data, ok := value.([]byte); ok {
+				id = string(data)
+			}
+		}
+		headings = append(headings, heading{
+			level: h.Level,
+			id:    id,
+			title: nodeText(h, source),
+			first: node == doc.FirstChild(),
+		})
+		return ast.WalkSkipChildren, nil
+	})
+	return headings
+}
+
+// nodeText returns the plain text of the node.
+func nodeText(node ast.Node, source []byte) string {
+	var buf strings.Builder
+	for child := node.FirstChild(); child != nil; child = child.NextSibling() {
+		switch n := child.(type) {
+		case *ast.Text:
+			buf.Write(n.Segment.Value(source))
+			if n.SoftLineBreak() || n.HardLineBreak() {
+				buf.WriteByte(' ')
+			}
+		case *ast.String:
+			buf.Write(n.Value)
+		default:
+			buf.WriteString(nodeText(child, source))
+		}
+	}
+	return buf.String()
+}
+
+// entityRef matches the named character reference.
+var entityRef = regexp.MustCompile(`&[a-zA-Z][a-zA-Z0-9]*;`)
+
+// numericEntities replaces the HTML named character references of the
+// content document, such as &copy; or &nbsp; in the template, with the numeric
+// ones: XML defines only the amp, lt, gt, quot and apos entities.
+func numericEntities(s string) string {
+	return entityRef.ReplaceAllStringFunc(s, func(ref string) string {
+		switch ref {
+		case "&amp;", "&lt;", "&gt;", "&quot;", "&apos;":
+			return ref
+		}
+		value := html.UnescapeString(ref)
+		if value == ref {
+			return "&amp;" + ref[1:] // unknown entity
+		}
+		var buf strings.Builder
+		for _, r := range value {
+			fmt.Fprintf(&buf, "&#%d;", r)
+		}
+		return buf.String()
+	})
+}
+
+// FrontMatter describes the YAML front matter of the Markdown file. The
+// defined values replace the publication metadata, except the authors and
+// subjects, which are added to the metadata unless they are already defined,
+// so the front matter repeated in several files does not duplicate them.
+type FrontMatter struct {
+	Title       string   `yaml:"title"`       // Publication title.
+	Authors     list     `yaml:"author"`      // Publication authors: the name or the list of names.
+	Language    string   `yaml:"lang"`        // Publication language.
+	Identifier  string   `yaml:"identifier"`  // Publication identifier, such as ISBN.
+	Description string   `yaml:"description"` // Publication description.
+	Publisher   string   `yaml:"publisher"`   // Publication publisher.
+	Rights      string   `yaml:"rights"`      // Publication rights.
+	Date        string   `yaml:"date"`        // Publication date: CCYY, CCYY-MM or CCYY-MM-DD.
+	Subjects    []string `yaml:"subjects"`    // Publication subjects.
+}
+
+// list is the list of strings that can be defined as a single string.
+type list []string
+
+// UnmarshalYAML implements yaml.Unmarshaler interface.
+func (l *list) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*l = list{value.Value}
+		return nil
+	}
+	return value.Decode((*[]string)(l))
+}
+
+// splitFrontMatter returns the parsed front matter delimited by “---” lines and
+// the rest of the source. Returns nil if there is no front matter.
+func splitFrontMatter(source []byte) (*FrontMatter, []byte, error) {
+	source = bytes.TrimPrefix(source, []byte("\ufeff"))
+	source = bytes.ReplaceAll(source, []byte("\r\n"), []byte("\n"))
+	if !bytes.HasPrefix(source, []byte("---\n")) {
+		return nil, source, nil
+	}
+	header := source[4:]
+	for offset := 0; offset < len(header); {
+		line, next := header[offset:], len(header)
+		if end := bytes.IndexByte(line, '\n'); end >= 0 {
+			line, next = line[:end], offset+end+1
+		}
+		if s := string(line); s == "---" || s == "..." {
+			front := new(FrontMatter)
+			if err := yaml.Unmarshal(header[:offset], front); err != nil {
+				return nil, nil, err
+			}
+			return front, header[next:], nil
+		}
+		offset = next
+	}
+	return nil, source, nil // no closing delimiter
+}
+
+// apply sets the publication metadata defined in the front matter.
+func (f *FrontMatter) apply(m *epub.Metadata) error {
+	if f.Title != "" {
+		m.Title = []epub.ElementLang{{Value: f.Title}}
+	}
+	m.Creator = addMissing(m.Creator, f.Authors)
+	if f.Language != "" {
+		if err := m.SetLang(f.Language); err != nil {
+			return err
+		}
+	}
+	if f.Identifier != "" {
+		m.Identifier = []epub.Element{{Value: f.Identifier, ID: "pub-id"}}
+	}
+	if f.Description != "" {
+		m.SetDescription(f.Description)
+	}
+	if f.Publisher != "" {
+		m.SetPublisher(f.Publisher)
+	}
+	if f.Rights != "" {
+		m.SetRights(f.Rights)
+	}
+	if f.Date != "" {
+		var parsed bool
+		for _, format := range []struct {
+			layout    string
+			precision epub.DatePrecision
+		}{
+			{"2006-01-02", epub.PrecisionDay},
+			{"2006-01", epub.PrecisionMonth},
+			{"2006", epub.PrecisionYear},
+		} {
+			if date, err := time.Parse(format.layout, f.Date); err == nil {
+				m.SetDate(date, format.precision)
+				parsed = true
+				break
+			}
+		}
+		if !parsed {
+			return fmt.Errorf("bad date %q", f.Date)
+		}
+	}
+	m.Subject = addMissing(m.Subject, f.Subjects)
+	return nil
+}
+
+// addMissing adds the values that are not in the list of elements yet.
+func addMissing(elements []epub.ElementLang, values []string) []epub.ElementLang {
+	for _, value := range values {
+		if !slices.ContainsFunc(elements, func(e epub.ElementLang) bool { return e.Value == value }) {
+			elements = append(elements, epub.ElementLang{Value: value})
+		}
+	}
+	return elements
+}
@@ -0,0 +1,44 @@
+package markdown_test
+
+import (
+	"io"
+	"testing"
+
+	epub "github.com/mdigger/epub3"
+	"github.com/mdigger/epub3/markdown"
+)
+
+func TestFrontMatterRepeated(t *testing.T) {
+	pub, err := epub.New(io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pub.Close()
+	pub.AddAuthors("Author")
+	b, err := markdown.NewBuilder(pub.Rendition)
+	if err != nil {
+		t.Fatal(err)
+	}
+	front := "---\ntitle: Book\nauthor: [Author, Editor]\nsubjects: [Fiction]\n---\n"
+	for _, name := range []string{"one.md", "two.md"} {
+		if err := b.Add(name, []byte(front+"# "+name+"\n\nText.\n")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var authors, subjects []string
+	for _, creator := range pub.Creator {
+		authors = append(authors, creator.Value)
+	}
+	for _, subject := range pub.Subject {
+		subjects = append(subjects, subject.Value)
+	}
+	if len(authors) != 2 || authors[0] != "Author" || authors[1] != "Editor" {
+		t.Errorf("authors = %q, want [Author Editor]", authors)
+	}
+	if len(subjects) != 1 || subjects[0] != "Fiction" {
+		t.Errorf("subjects = %q, want [Fiction]", subjects)
+	}
+	if title := pub.Title; len(title) != 1 || title[0].Value != "Book" {
+		t.Errorf("title = %v, want Book", title)
+	}
+}
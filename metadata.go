@@ -1,14 +1,21 @@
 package epub
 
 import (
+	"encoding/xml"
 	"fmt"
 	"time"
+
+	"golang.org/x/text/language"
 )
 
 // Element with optional ID.
 type Element struct {
-	Value string `xml:",chardata"`
-	ID    string `xml:"id,attr,omitempty"` // The ID of this element, which must be unique within the document scope.
+	Value      string      `xml:",chardata"`
+	ID         string      `xml:"id,attr,omitempty"`         // The ID of this element, which must be unique within the document scope.
+	Scheme     string      `xml:"opf:scheme,attr,omitempty"` // EPUB 2: the identifier scheme, such as “ISBN”.
+	Event      string      `xml:"opf:event,attr,omitempty"`  // EPUB 2: the event of the date, such as “publication”.
+	Attrs      []xml.Attr  `xml:",any,attr"`
+	Extensions []Extension `xml:",any"`
 }
 
 // ElementLang with optional ID, xml:lang & dir.
@@ -17,11 +24,17 @@ type ElementLang struct {
 	ID    string `xml:"id,attr,omitempty"`       // The ID of this element, which must be unique within the document scope.
 	Dir   string `xml:"dir,attr,omitempty"`      // Specifies the base text direction of the content and attribute values of the carrying element and its descendants.
 	Lang  string `xml:"xml:lang,attr,omitempty"` // Specifies the language used in the contents and attribute values of the carrying element and its descendants
+	// EPUB 2 attributes
+	Role       string      `xml:"opf:role,attr,omitempty"`    // The MARC relator code of the creator or contributor role.
+	FileAs     string      `xml:"opf:file-as,attr,omitempty"` // The normalized form of the name used for sorting.
+	Attrs      []xml.Attr  `xml:",any,attr"`
+	Extensions []Extension `xml:",any"`
 }
 
 // Metadata element encapsulates Publication meta information.
 type Metadata struct {
-	DC string `xml:"xmlns:dc,attr"` // “http://purl.org/dc/elements/1.1/”
+	DC  string `xml:"xmlns:dc,attr,omitempty"`  // “http://purl.org/dc/elements/1.1/”
+	OPF string `xml:"xmlns:opf,attr,omitempty"` // “http://www.idpf.org/2007/opf”, used by EPUB 2 attributes
 	// Required Elements
 	Identifier []Element     `xml:"dc:identifier"` // The [DCMES] identifier element contains a single identifier associated with the EPUB Publication, such as a UUID, DOI, ISBN or ISSN.
 	Title      []ElementLang `xml:"dc:title"`      // The [DCMES] title element represents an instance of a name given to the EPUB Publication.
@@ -40,8 +53,42 @@ type Metadata struct {
 	Coverage    []ElementLang `xml:"dc:coverage,omitempty"`
 	Rights      []ElementLang `xml:"dc:rights,omitempty"`
 	// Meta
-	Meta []Meta `xml:"meta,omitempty"` // The meta element provides a generic means of including package metadata, allowing the expression of primary metadata about the package or content and refinement of that metadata.
-	Link []Link `xml:"link,omitempty"` // The link element is used to associate resources with a Publication, such as metadata records.
+	Meta       []Meta      `xml:"meta,omitempty"` // The meta element provides a generic means of including package metadata, allowing the expression of primary metadata about the package or content and refinement of that metadata.
+	Link       []Link      `xml:"link,omitempty"` // The link element is used to associate resources with a Publication, such as metadata records.
+	Attrs      []xml.Attr  `xml:",any,attr"`
+	Extensions []Extension `xml:",any"`
+
+	modified bool      // dcterms:modified is set with SetModified
+	dates    []Element // all dc:date elements of the EPUB 2 package
+}
+
+// UnmarshalXML implements xml.Unmarshaler interface. The first date element
+// is the publication date; all date elements of the EPUB 2 package with
+// different events are kept for UpgradePackage.
+func (m *Metadata) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	if err := decodeNodes(d, start, m); err != nil {
+		return err
+	}
+	if len(m.dates) < 2 {
+		m.dates = nil
+	}
+	return nil
+}
+
+// decodeChild implements childDecoder interface: all date elements are kept.
+func (m *Metadata) decodeChild(d *xml.Decoder, start xml.StartElement) (int, bool, error) {
+	if start.Name.Local != "dc:date" {
+		return 0, false, nil
+	}
+	var date Element
+	if err := d.DecodeElement(&date, &start); err != nil {
+		return 0, false, err
+	}
+	m.dates = append(m.dates, date)
+	if m.Date == nil {
+		m.Date = &date
+	}
+	return len(m.dates) - 1, true, nil
 }
 
 // AddTitle new publication title.
@@ -73,22 +120,130 @@ func (m *Metadata) SetRights(rights string) {
 	m.Rights = []ElementLang{{Value: rights}}
 }
 
-// SetDate set publication date (not last modified).
-func (m *Metadata) SetDate(date string) (err error) {
-	// check data format
-	var dateTime time.Time
-	for _, layout := range []string{"2006-01-02", "2006-01", "2006", time.RFC3339} {
-		if dateTime, err = time.Parse(layout, date); err == nil {
-			break
+// DatePrecision describes the precision of the publication date.
+type DatePrecision byte
+
+// Supported date precisions of W3CDTF format.
+const (
+	PrecisionDay    DatePrecision = iota // CCYY-MM-DD
+	PrecisionMonth                       // CCYY-MM
+	PrecisionYear                        // CCYY
+	PrecisionSecond                      // CCYY-MM-DDThh:mm:ssZ
+)
+
+// layout returns the time format layout for the precision.
+func (p DatePrecision) layout() string {
+	switch p {
+	case PrecisionYear:
+		return "2006"
+	case PrecisionMonth:
+		return "2006-01"
+	case PrecisionSecond:
+		return ModifiedLayout
+	default:
+		return "2006-01-02"
+	}
+}
+
+// formatDate returns the date in W3CDTF format with the given precision.
+func formatDate(t time.Time, precision DatePrecision) string {
+	if precision == PrecisionSecond {
+		t = t.UTC()
+	}
+	return t.Format(precision.layout())
+}
+
+// parseDate parses the date in W3CDTF format.
+func parseDate(value string) (time.Time, error) {
+	for _, layout := range []string{"2006-01-02", "2006-01", "2006",
+		time.RFC3339, "2006-01-02T15:04Z07:00"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
 		}
 	}
-	if dateTime.IsZero() {
-		return fmt.Errorf("bad date %v", date)
+	return time.Time{}, fmt.Errorf("bad date %q", value)
+}
+
+// SetDate set publication date (not last modified) with the given precision.
+func (m *Metadata) SetDate(date time.Time, precision DatePrecision) {
+	m.Date = &Element{Value: formatDate(date, precision)}
+}
+
+// PublicationDate returns publication date (not last modified).
+// Return zero time if it is not defined.
+func (m *Metadata) PublicationDate() (time.Time, error) {
+	if m.Date == nil {
+		return time.Time{}, nil
 	}
+	return parseDate(m.Date.Value)
+}
+
+// Properties of the additional publication dates.
+const (
+	DateCreated     = "dcterms:created"         // Date of creation of the resource.
+	DateIssued      = "dcterms:issued"          // Date of formal issuance of the resource.
+	DateCopyrighted = "dcterms:dateCopyrighted" // Date of copyright of the resource.
+)
 
-	// set publication date
-	m.Date = &Element{Value: date}
+// SetMetaDate set the additional publication date defined by the meta
+// property, such as DateIssued, DateCreated or DateCopyrighted.
+func (m *Metadata) SetMetaDate(property string, date time.Time, precision DatePrecision) {
+	value := formatDate(date, precision)
+	for i, item := range m.Meta {
+		if item.Property == property && item.Refines == "" {
+			m.Meta[i].Value = value
+			return
+		}
+	}
+	m.Meta = append(m.Meta, Meta{Property: property, Value: value})
+}
 
+// MetaDate returns the additional publication date defined by the meta
+// property. Return zero time if it is not defined.
+func (m *Metadata) MetaDate(property string) (time.Time, error) {
+	for _, item := range m.Meta {
+		if item.Property == property && item.Refines == "" {
+			return parseDate(item.Value)
+		}
+	}
+	return time.Time{}, nil
+}
+
+// ModifiedLayout is the format of the publication modification time
+// (dcterms:modified) required by EPUB 3: CCYY-MM-DDThh:mm:ssZ.
+const ModifiedLayout = "2006-01-02T15:04:05Z"
+
+// SetModified set publication last modified time (dcterms:modified).
+// Writer and Editor keep the time set with SetModified; the time defined
+// otherwise, such as read with the package, is replaced with the current time
+// unless the PreserveModified option is used.
+func (m *Metadata) SetModified(t time.Time) {
+	m.SetMetaDate("dcterms:modified", t, PrecisionSecond)
+	m.modified = true
+}
+
+// Modified returns publication last modified time (dcterms:modified).
+// Return zero time if it is not defined.
+func (m *Metadata) Modified() (time.Time, error) {
+	for _, item := range m.Meta {
+		if item.Property == "dcterms:modified" && item.Refines == "" {
+			if err := checkModified(item.Value); err != nil {
+				return time.Time{}, err
+			}
+			return time.Parse(ModifiedLayout, item.Value)
+		}
+	}
+	return time.Time{}, nil
+}
+
+// checkModified returns an error if the value is not in the dcterms:modified
+// format.
+func checkModified(value string) error {
+	// time.Parse also accepts fractional seconds, so the length is checked too
+	if _, err := time.Parse(ModifiedLayout, value); err != nil ||
+		len(value) != len(ModifiedLayout) {
+		return fmt.Errorf("bad modified time %q: must be in the form CCYY-MM-DDThh:mm:ssZ", value)
+	}
 	return nil
 }
 
@@ -100,33 +255,109 @@ func (m *Metadata) SetUUID(id string) {
 	m.Identifier = []Element{{Value: id, ID: "uuid"}}
 }
 
+// NewID returns the identifier with the given prefix and the number, which is
+// not used by the metadata entries yet.
+func (m *Metadata) NewID(prefix string) string {
+	ids := m.ids()
+	for n := 1; ; n++ {
+		if id := fmt.Sprintf("%s%02d", prefix, n); !ids[id] {
+			return id
+		}
+	}
+}
+
 // SetPublisher set publication publisher.
 func (m *Metadata) SetPublisher(name string) {
 	m.Publisher = []ElementLang{{Value: name}}
 }
 
-// SetLang set publication language.
-func (m *Metadata) SetLang(lang string) {
-	m.Language = []Element{{Value: lang}}
+// SetLang set publication languages. The first language is the primary language
+// of the publication. Languages must be well-formed BCP 47 tags.
+func (m *Metadata) SetLang(primary string, others ...string) error {
+	list := make([]Element, 0, len(others)+1)
+	for _, lang := range append([]string{primary}, others...) {
+		tag, err := language.Parse(lang)
+		if err != nil {
+			return fmt.Errorf("bad language tag %q: %w", lang, err)
+		}
+		list = append(list, Element{Value: tag.String()})
+	}
+	m.Language = list
+	return nil
+}
+
+// Lang returns the primary publication language.
+func (m *Metadata) Lang() string {
+	if len(m.Language) == 0 {
+		return ""
+	}
+	return m.Language[0].Value
+}
+
+// CheckLang returns the list of errors for malformed BCP 47 language tags used
+// in the publication languages and in the language attributes of elements.
+func (m *Metadata) CheckLang() []error {
+	var errs []error
+	check := func(name, value, lang string) {
+		if lang == "" {
+			return
+		}
+		if _, err := language.Parse(lang); err != nil {
+			errs = append(errs, fmt.Errorf("%s %q: bad language tag %q: %w",
+				name, value, lang, err))
+		}
+	}
+	for _, item := range m.Language {
+		check("language", item.Value, item.Value)
+	}
+	for _, list := range []struct {
+		name  string
+		items []ElementLang
+	}{
+		{"title", m.Title},
+		{"creator", m.Creator},
+		{"contributor", m.Contributor},
+		{"subject", m.Subject},
+		{"description", m.Description},
+		{"publisher", m.Publisher},
+		{"relation", m.Relation},
+		{"coverage", m.Coverage},
+		{"rights", m.Rights},
+	} {
+		for _, item := range list.items {
+			check(list.name, item.Value, item.Lang)
+		}
+	}
+	for _, item := range m.Meta {
+		check("meta "+item.Property, item.Value, item.Lang)
+	}
+	return errs
 }
 
 // Meta element provides a generic means of including package metadata, allowing the expression
 // of primary metadata about the package or content and refinement of that metadata.
 type Meta struct {
 	Refines  string `xml:"refines,attr,omitempty"`  // Identifies the expression or resource augmented by this element. The value of the attribute must be a relative IRI [RFC3987] pointing to the resource or element it describes.
-	Property string `xml:"property,attr"`           // A property. Refer to Vocabulary Association Mechanisms for more information.
+	Property string `xml:"property,attr,omitempty"` // A property. Refer to Vocabulary Association Mechanisms for more information.
 	Scheme   string `xml:"scheme,attr,omitempty"`   // A property data type value indicating the source the value of the element is drawn from.
 	ID       string `xml:"id,attr,omitempty"`       // The ID of this element, which must be unique within the document scope.
 	Dir      string `xml:"dir,attr,omitempty"`      // Specifies the base text direction of the content and attribute values of the carrying element and its descendants.
 	Lang     string `xml:"xml:lang,attr,omitempty"` // Specifies the language used in the contents and attribute values of the carrying element and its descendants
 	Value    string `xml:",chardata"`
+	// EPUB 2 attributes
+	Name       string      `xml:"name,attr,omitempty"`    // The name of the EPUB 2 meta element, such as “cover”.
+	Content    string      `xml:"content,attr,omitempty"` // The value of the EPUB 2 meta element.
+	Attrs      []xml.Attr  `xml:",any,attr"`
+	Extensions []Extension `xml:",any"`
 }
 
 // Link element is used to associate resources with a Publication, such as metadata records.
 type Link struct {
-	Refines   string `xml:"refines,attr,omitempty"`    // Identifies the expression or resource augmented by this element. The value of the attribute must be a relative IRI [RFC3987] pointing to the resource or element it describes.
-	Rel       string `xml:"rel,attr"`                  // A space-separated list of property values.
-	Href      string `xml:"href,attr"`                 // An absolute or relative IRI reference [RFC3987] to a resource.
-	ID        string `xml:"id,attr,omitempty"`         // The ID [XML] of this element, which must be unique within the document scope.
-	MediaType string `xml:"media-type,attr,omitempty"` // A media type [RFC2046] that specifies the type and format of the resource referenced by this link.
+	Refines    string      `xml:"refines,attr,omitempty" json:"refines,omitempty"`       // Identifies the expression or resource augmented by this element. The value of the attribute must be a relative IRI [RFC3987] pointing to the resource or element it describes.
+	Rel        string      `xml:"rel,attr,omitempty" json:"rel,omitempty"`               // A space-separated list of property values.
+	Href       string      `xml:"href,attr" json:"href"`                                 // An absolute or relative IRI reference [RFC3987] to a resource.
+	ID         string      `xml:"id,attr,omitempty" json:"id,omitempty"`                 // The ID [XML] of this element, which must be unique within the document scope.
+	MediaType  string      `xml:"media-type,attr,omitempty" json:"media-type,omitempty"` // A media type [RFC2046] that specifies the type and format of the resource referenced by this link.
+	Attrs      []xml.Attr  `xml:",any,attr" json:"-"`
+	Extensions []Extension `xml:",any" json:"-"`
 }
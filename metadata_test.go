@@ -0,0 +1,117 @@
+package epub_test
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	epub "github.com/mdigger/epub3"
+)
+
+func TestDates(t *testing.T) {
+	var m epub.Metadata
+	if date, err := m.PublicationDate(); err != nil || !date.IsZero() {
+		t.Errorf("PublicationDate() = %v, %v; want zero time", date, err)
+	}
+	if date, err := m.MetaDate(epub.DateIssued); err != nil || !date.IsZero() {
+		t.Errorf("MetaDate() = %v, %v; want zero time", date, err)
+	}
+	if date, err := m.Modified(); err != nil || !date.IsZero() {
+		t.Errorf("Modified() = %v, %v; want zero time", date, err)
+	}
+
+	local := time.FixedZone("UTC+3", 3*60*60)
+	date := time.Date(2020, 5, 6, 1, 2, 3, 0, local)
+	for _, test := range []struct {
+		precision epub.DatePrecision
+		want      string
+	}{
+		{epub.PrecisionSecond, "2020-05-05T22:02:03Z"},
+		{epub.PrecisionDay, "2020-05-06"},
+		{epub.PrecisionMonth, "2020-05"},
+		{epub.PrecisionYear, "2020"},
+	} {
+		m.SetDate(date, test.precision)
+		if m.Date.Value != test.want {
+			t.Errorf("SetDate(%v) = %q, want %q", test.precision, m.Date.Value, test.want)
+		}
+		if _, err := m.PublicationDate(); err != nil {
+			t.Errorf("PublicationDate(%q): %v", m.Date.Value, err)
+		}
+	}
+
+	m.SetMetaDate(epub.DateIssued, date, epub.PrecisionSecond)
+	m.SetMetaDate(epub.DateIssued, date.Add(time.Hour), epub.PrecisionSecond)
+	var issued int
+	for _, meta := range m.Meta {
+		if meta.Property == epub.DateIssued {
+			issued++
+		}
+	}
+	if issued != 1 {
+		t.Errorf("%d dcterms:issued elements, want 1", issued)
+	}
+	if got, err := m.MetaDate(epub.DateIssued); err != nil || !got.Equal(date.Add(time.Hour)) {
+		t.Errorf("MetaDate() = %v, %v; want %v", got, err, date.Add(time.Hour))
+	}
+
+	m.SetModified(date)
+	if got, err := m.Modified(); err != nil || !got.Equal(date) {
+		t.Errorf("Modified() = %v, %v; want %v", got, err, date)
+	}
+	m.Date.Value = "May 2020"
+	if _, err := m.PublicationDate(); err == nil {
+		t.Error("PublicationDate() of the malformed date returns no error")
+	}
+}
+
+func TestLang(t *testing.T) {
+	var m epub.Metadata
+	if err := m.SetLang("en-us", "ru"); err != nil {
+		t.Fatal(err)
+	}
+	if m.Lang() != "en-US" || len(m.Language) != 2 || m.Language[1].Value != "ru" {
+		t.Errorf("languages = %+v", m.Language)
+	}
+	if err := m.SetLang("en", "not a tag"); err == nil {
+		t.Error("SetLang() of the malformed tag returns no error")
+	}
+	if m.Lang() != "en-US" {
+		t.Errorf("languages are changed on error: %+v", m.Language)
+	}
+	if errs := m.CheckLang(); len(errs) != 0 {
+		t.Errorf("CheckLang() = %v", errs)
+	}
+	m.Title = []epub.ElementLang{{Value: "Title", Lang: "en_GB!"}}
+	if errs := m.CheckLang(); len(errs) != 1 {
+		t.Errorf("CheckLang() = %v, want one error", errs)
+	}
+}
+
+func TestLangWarning(t *testing.T) {
+	var warnings []error
+	pub, err := epub.New(io.Discard, epub.OnWarning(func(err error) {
+		warnings = append(warnings, err)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub.AddTitle("Title")
+	pub.Title[0].Lang = "bad tag"
+	if err := pub.AddContent(strings.NewReader(testDocument("Text", "Text.")),
+		"text.xhtml", epub.Primary); err != nil {
+		t.Fatal(err)
+	}
+	if err := pub.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 2 {
+		t.Fatalf("warnings = %v, want missing and bad language", warnings)
+	}
+	for i, want := range []string{`language is not defined, "en" is used`, `bad language tag "bad tag"`} {
+		if !strings.Contains(warnings[i].Error(), want) {
+			t.Errorf("warning = %q, want %q", warnings[i], want)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package epub
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/mdigger/epub3/internal/ocf"
+)
+
+// NavFilename is the name of the generated navigation document.
+const NavFilename = "nav.xhtml"
+
+// NavPoint describes the entry of the publication table of contents.
+type NavPoint struct {
+	Title    string      // Title of the entry.
+	Href     string      // Name of the content document with optional fragment identifier.
+	Children []*NavPoint // Nested entries.
+}
+
+// Add adds the nested entry of the table of contents and returns it.
+func (p *NavPoint) Add(title, href string) *NavPoint {
+	point := &NavPoint{Title: title, Href: filepath.ToSlash(href)}
+	p.Children = append(p.Children, point)
+	return point
+}
+
+// Landmark describes the reference to the key structural part of the
+// publication, such as the cover, the start of the body matter or the index.
+type Landmark struct {
+	Type  string // Structural semantics of the referenced part, such as "cover", "bodymatter" or "index".
+	Title string // Title of the reference.
+	Href  string // Name of the content document with optional fragment identifier.
+}
+
+// AddTOC adds the top-level entry of the publication table of contents and
+// returns it. The navigation document with the table of contents is generated
+// on Close if it was not added with the "nav" property.
+func (r *Rendition) AddTOC(title, href string) *NavPoint {
+	point := &NavPoint{Title: title, Href: filepath.ToSlash(href)}
+	r.toc = append(r.toc, point)
+	return point
+}
+
+// AddLandmark adds the reference to the key structural part of the
+// publication to the landmarks of the generated navigation document.
+func (r *Rendition) AddLandmark(typ, title, href string) {
+	r.landmarks = append(r.landmarks,
+		Landmark{Type: typ, Title: title, Href: filepath.ToSlash(href)})
+}
+
+// addNav generates the navigation document and adds it to the publication.
+// The document is not generated if it is already added or there are no table
+// of contents and landmarks entries.
+func (r *Rendition) addNav(ctx context.Context, metadata *Metadata) error {
+	for _, item := range r.manifest {
+		if hasProperty(item.Properties, "nav") {
+			if len(r.toc) > 0 || len(r.landmarks) > 0 {
+				r.writer.warn(fmt.Errorf("navigation document %q is already added, generated entries are ignored",
+					item.Href))
+			}
+			return nil
+		}
+	}
+	if len(r.toc) == 0 && len(r.landmarks) == 0 {
+		return nil
+	}
+
+	var title string
+	if len(metadata.Title) > 0 {
+		title = metadata.Title[0].Value
+	}
+	data, err := navDocument(title, metadata.Lang(), r.navPoints(), r.landmarks)
+	if err != nil {
+		return err
+	}
+	return r.addContent(ctx, bytes.NewReader(data), NavFilename, "application/xhtml+xml", Media,
+		[]string{"nav"})
+}
+
+// navPoints returns the table of contents entries. The table of contents is
+// required, so the entries are generated from the spine if it is not defined.
+func (r *Rendition) navPoints() []*NavPoint {
+	if len(r.toc) > 0 {
+		return r.toc
+	}
+	var toc []*NavPoint
+	for _, itemref := range r.spine {
+		if itemref.Linear == "no" {
+			continue
+		}
+		for _, item := range r.manifest {
+			if item.ID == itemref.IDRef {
+				title := strings.TrimSuffix(path.Base(item.Href), path.Ext(item.Href))
+				toc = append(toc, &NavPoint{Title: title, Href: item.Href})
+				break
+			}
+		}
+	}
+	return toc
+}
+
+// navDocument returns the navigation document with the table of contents and
+// the landmarks. The references are relative to the folder of the document.
+func navDocument(title, lang string, toc []*NavPoint, landmarks []Landmark) ([]byte, error) {
+	html, body := newDocument(title, lang)
+	body.add(newElement("nav", "epub:type", "toc", "id", "toc").add(
+		newElement("h1").add(title),
+		navList(toc),
+	))
+	if len(landmarks) > 0 {
+		list := newElement("ol")
+		for _, landmark := range landmarks {
+			list.add(newElement("li").add(
+				newElement("a",
+					"epub:type", landmark.Type,
+					"href", ocf.Relative(NavFilename, landmark.Href),
+				).add(landmark.Title)))
+		}
+		body.add(newElement("nav", "epub:type", "landmarks", "id", "landmarks",
+			"hidden", "hidden").add(list))
+	}
+
+	var buf bytes.Buffer
+	if err := encodeXML(&buf, "html", html); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// navList returns the ordered list of the table of contents entries.
+func navList(points []*NavPoint) *element {
+	list := newElement("ol")
+	for _, point := range points {
+		var label *element
+		if point.Href != "" {
+			label = newElement("a", "href", ocf.Relative(NavFilename, point.Href))
+		} else {
+			label = newElement("span")
+		}
+		item := newElement("li").add(label.add(point.Title))
+		if len(point.Children) > 0 {
+			item.add(navList(point.Children))
+		}
+		list.add(item)
+	}
+	return list
+}
+
+// hasProperty returns true if the space-separated list of properties contains
+// the property.
+func hasProperty(properties, property string) bool {
+	for _, value := range strings.Fields(properties) {
+		if value == property {
+			return true
+		}
+	}
+	return false
+}
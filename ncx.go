@@ -0,0 +1,121 @@
+package epub
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+
+	"github.com/mdigger/epub3/internal/ocf"
+)
+
+// nsNCX is the namespace of the EPUB 2 navigation control file.
+const nsNCX = "http://www.daisy.org/z3986/2005/ncx/"
+
+// NCXFilename is the name of the generated EPUB 2 navigation control file.
+const NCXFilename = "toc.ncx"
+
+// NCX describes the EPUB 2 navigation control file (toc.ncx), superseded by
+// the navigation document in EPUB 3.
+type NCX struct {
+	XMLName  xml.Name     `xml:"http://www.daisy.org/z3986/2005/ncx/ ncx"`
+	Version  string       `xml:"version,attr"`
+	Lang     string       `xml:"xml:lang,attr,omitempty"`
+	Head     []NCXMeta    `xml:"head>meta"`          // Metadata, such as dtb:uid and dtb:depth.
+	Title    string       `xml:"docTitle>text"`      // Title of the publication.
+	NavMap   []NCXPoint   `xml:"navMap>navPoint"`    // Table of contents.
+	PageList *NCXPageList `xml:"pageList,omitempty"` // Page list.
+}
+
+// NCXMeta is the metadata entry of the NCX head.
+type NCXMeta struct {
+	Name    string `xml:"name,attr"`
+	Content string `xml:"content,attr"`
+}
+
+// NCXPoint is the entry of the NCX table of contents.
+type NCXPoint struct {
+	ID        string     `xml:"id,attr"`
+	PlayOrder int        `xml:"playOrder,attr,omitempty"`
+	Label     string     `xml:"navLabel>text"`      // Title of the entry.
+	Content   NCXContent `xml:"content"`            // Reference to the content.
+	Children  []NCXPoint `xml:"navPoint,omitempty"` // Nested entries.
+}
+
+// NCXPageList is the NCX page list.
+type NCXPageList struct {
+	Targets []NCXPage `xml:"pageTarget"`
+}
+
+// NCXPage is the entry of the NCX page list.
+type NCXPage struct {
+	ID        string     `xml:"id,attr"`
+	Type      string     `xml:"type,attr"`
+	Value     string     `xml:"value,attr,omitempty"`
+	PlayOrder int        `xml:"playOrder,attr,omitempty"`
+	Label     string     `xml:"navLabel>text"`
+	Content   NCXContent `xml:"content"`
+}
+
+// NCXContent is the reference to the content of the NCX entry.
+type NCXContent struct {
+	Src string `xml:"src,attr"`
+}
+
+// ReadNCX parses the EPUB 2 navigation control file.
+func ReadNCX(r io.Reader) (*NCX, error) {
+	ncx := new(NCX)
+	if err := xml.NewDecoder(r).Decode(ncx); err != nil {
+		return nil, err
+	}
+	return ncx, nil
+}
+
+// ncxDocument returns the navigation control file with the table of contents.
+// The references are relative to the folder of the file.
+func ncxDocument(uid, title, lang string, toc []*NavPoint) ([]byte, error) {
+	var (
+		order int // reading order of the entries
+		depth int // maximum depth of the table of contents
+	)
+	var convert func(points []*NavPoint, level int) []NCXPoint
+	convert = func(points []*NavPoint, level int) []NCXPoint {
+		list := make([]NCXPoint, 0, len(points))
+		for _, point := range points {
+			if point.Href == "" {
+				// NCX entries must refer to the content
+				list = append(list, convert(point.Children, level)...)
+				continue
+			}
+			order++
+			depth = max(depth, level)
+			list = append(list, NCXPoint{
+				ID:        fmt.Sprintf("navpoint%02d", order),
+				PlayOrder: order,
+				Label:     point.Title,
+				Content:   NCXContent{Src: ocf.Relative(NCXFilename, point.Href)},
+			})
+			list[len(list)-1].Children = convert(point.Children, level+1)
+		}
+		return list
+	}
+	navMap := convert(toc, 1)
+	ncx := NCX{
+		Version: "2005-1",
+		Lang:    lang,
+		Head: []NCXMeta{
+			{Name: "dtb:uid", Content: uid},
+			{Name: "dtb:depth", Content: fmt.Sprint(depth)},
+			{Name: "dtb:totalPageCount", Content: "0"},
+			{Name: "dtb:maxPageNumber", Content: "0"},
+		},
+		Title:  title,
+		NavMap: navMap,
+	}
+
+	var buf bytes.Buffer
+	if err := encodeXML(&buf, "", ncx); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,409 @@
+package epub
+
+import (
+	"encoding/xml"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// xmlField describes the field of the package structure in XML.
+type xmlField struct {
+	index     int
+	name      string // name of the element or attribute
+	omitEmpty bool   // attribute is not written if empty
+}
+
+// xmlFields describes the fields of the package structure.
+type xmlFields struct {
+	space      string // namespace of the element defined by the XMLName field
+	local      string // name of the element defined by the XMLName field
+	attrs      []xmlField
+	elements   []xmlField
+	chardata   int // index of the text field or -1
+	anyAttrs   int // index of the unknown attributes field or -1
+	extensions int // index of the unknown nodes field
+}
+
+// fieldsCache holds the descriptions of the package structures by type.
+var fieldsCache sync.Map
+
+// fieldsOf returns the description of the package structure type.
+func fieldsOf(typ reflect.Type) *xmlFields {
+	if fields, ok := fieldsCache.Load(typ); ok {
+		return fields.(*xmlFields)
+	}
+	fields := &xmlFields{chardata: -1, anyAttrs: -1, extensions: -1}
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		tag := field.Tag.Get("xml")
+		if field.PkgPath != "" || tag == "-" {
+			continue // unexported
+		}
+		name, flags, _ := strings.Cut(tag, ",")
+		switch {
+		case field.Name == "XMLName":
+			if space, local, ok := strings.Cut(name, " "); ok {
+				fields.space, fields.local = space, local
+			} else {
+				fields.local = name
+			}
+		case flags == "any,attr":
+			fields.anyAttrs = i
+		case flags == "any":
+			fields.extensions = i
+		case flags == "chardata":
+			fields.chardata = i
+		case strings.HasPrefix(flags, "attr"):
+			fields.attrs = append(fields.attrs,
+				xmlField{index: i, name: name, omitEmpty: flags == "attr,omitempty"})
+		default:
+			fields.elements = append(fields.elements, xmlField{index: i, name: name})
+		}
+	}
+	if fields.extensions < 0 {
+		panic(fmt.Sprintf("epub: %v has no extensions field", typ))
+	}
+	fieldsCache.Store(typ, fields)
+	return fields
+}
+
+// childDecoder is implemented by the package structures with the special
+// decoding of some child elements.
+type childDecoder interface {
+	// decodeChild decodes the child element and returns true and the index
+	// of the element in the list of such elements if it is decoded.
+	decodeChild(d *xml.Decoder, start xml.StartElement) (int, bool, error)
+}
+
+// decodeNodes decodes the element to the package structure v. The unknown
+// attributes are added to the Attrs field, the unknown elements and comments
+// to the Extensions field with the position after the preceding known element.
+func decodeNodes(d *xml.Decoder, start xml.StartElement, v interface{}) error {
+	value := reflect.ValueOf(v).Elem()
+	fields := fieldsOf(value.Type())
+	if fields.local != "" {
+		value.FieldByName("XMLName").Set(reflect.ValueOf(start.Name))
+	}
+	var attrs []xml.Attr
+next:
+	for _, attr := range start.Attr {
+		for _, field := range fields.attrs {
+			if field.name == attr.Name.Local && attr.Name.Space == "" {
+				value.Field(field.index).SetString(attr.Value)
+				continue next
+			}
+		}
+		attrs = append(attrs, attr)
+	}
+	if fields.anyAttrs >= 0 {
+		value.Field(fields.anyAttrs).Set(reflect.ValueOf(attrs))
+	}
+
+	var (
+		nodes []Extension
+		text  []byte
+		after nodePosition // position after the last known element
+	)
+	for {
+		token, err := d.Token()
+		if err != nil {
+			return err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			if decoder, ok := v.(childDecoder); ok {
+				index, decoded, err := decoder.decodeChild(d, t)
+				if err != nil {
+					return err
+				}
+				if decoded {
+					after = nodePosition{name: t.Name.Local, index: index}
+					continue
+				}
+			}
+			if field, ok := fields.element(t.Name); ok {
+				index, err := decodeField(d, t, value.Field(field.index))
+				if err != nil {
+					return err
+				}
+				after = nodePosition{name: field.name, index: index}
+				continue
+			}
+			var node Extension
+			if err := node.UnmarshalXML(d, t); err != nil {
+				return err
+			}
+			position := after
+			node.position = &position
+			nodes = append(nodes, node)
+		case xml.Comment:
+			position := after
+			nodes = append(nodes, Extension{Comment: string(t), position: &position})
+		case xml.CharData:
+			if fields.chardata >= 0 {
+				text = append(text, t...)
+			}
+		case xml.EndElement:
+			if fields.chardata >= 0 {
+				value.Field(fields.chardata).SetString(string(text))
+			}
+			value.Field(fields.extensions).Set(reflect.ValueOf(nodes))
+			return nil
+		}
+	}
+}
+
+// element returns the description of the known child element with the name.
+func (f *xmlFields) element(name xml.Name) (xmlField, bool) {
+	if name.Space != "" && name.Space != nsOPF {
+		return xmlField{}, false
+	}
+	for _, field := range f.elements {
+		if field.name == name.Local {
+			return field, true
+		}
+	}
+	return xmlField{}, false
+}
+
+// decodeField decodes the child element to the field and returns its index
+// in the field list.
+func decodeField(d *xml.Decoder, start xml.StartElement, field reflect.Value) (int, error) {
+	switch field.Kind() {
+	case reflect.Slice:
+		item := reflect.New(field.Type().Elem())
+		if err := d.DecodeElement(item.Interface(), &start); err != nil {
+			return 0, err
+		}
+		field.Set(reflect.Append(field, item.Elem()))
+		return field.Len() - 1, nil
+	case reflect.Ptr:
+		item := reflect.New(field.Type().Elem())
+		if err := d.DecodeElement(item.Interface(), &start); err != nil {
+			return 0, err
+		}
+		field.Set(item)
+		return 0, nil
+	default:
+		return 0, d.DecodeElement(field.Addr().Interface(), &start)
+	}
+}
+
+// nodePosition is the position of the extension read from the document: the
+// extension follows the known child element with the name and the index in
+// the list of such elements, or starts the content if the name is empty.
+type nodePosition struct {
+	name  string
+	index int
+}
+
+// encodeNodes encodes the package structure v with the extensions placed
+// after the known elements they followed in the read document. Other
+// extensions are written after the known elements.
+func encodeNodes(enc *xml.Encoder, start xml.StartElement, v interface{}) error {
+	value := reflect.ValueOf(v).Elem()
+	fields := fieldsOf(value.Type())
+	if fields.local != "" {
+		start.Name = xml.Name{Space: fields.space, Local: fields.local}
+	}
+	start.Attr = nil
+	for _, field := range fields.attrs {
+		if attr := value.Field(field.index).String(); attr != "" || !field.omitEmpty {
+			start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: field.name}, Value: attr})
+		}
+	}
+	if fields.anyAttrs >= 0 {
+		start.Attr = append(start.Attr, value.Field(fields.anyAttrs).Interface().([]xml.Attr)...)
+	}
+	if err := enc.EncodeToken(start); err != nil {
+		return err
+	}
+	if fields.chardata >= 0 {
+		if text := value.Field(fields.chardata).String(); text != "" {
+			if err := enc.EncodeToken(xml.CharData(text)); err != nil {
+				return err
+			}
+		}
+	}
+
+	nodes := value.Field(fields.extensions).Interface().([]Extension)
+	written := make([]bool, len(nodes))
+	// writeNodes writes the extensions placed after the position
+	writeNodes := func(name string, index int) error {
+		for i, node := range nodes {
+			if !written[i] && node.position != nil &&
+				node.position.name == name && node.position.index == index {
+				written[i] = true
+				if err := enc.Encode(node); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	if err := writeNodes("", 0); err != nil {
+		return err
+	}
+	for _, field := range fields.elements {
+		child := xml.StartElement{Name: xml.Name{Local: field.name}}
+		value := value.Field(field.index)
+		switch value.Kind() {
+		case reflect.Slice:
+			for i := 0; i < value.Len(); i++ {
+				if err := enc.EncodeElement(value.Index(i).Interface(), child); err != nil {
+					return err
+				}
+				if err := writeNodes(field.name, i); err != nil {
+					return err
+				}
+			}
+		case reflect.Ptr:
+			if value.IsNil() {
+				continue
+			}
+			fallthrough
+		default:
+			if err := enc.EncodeElement(value.Interface(), child); err != nil {
+				return err
+			}
+			if err := writeNodes(field.name, 0); err != nil {
+				return err
+			}
+		}
+	}
+	for i, node := range nodes {
+		if !written[i] {
+			if err := enc.Encode(node); err != nil {
+				return err
+			}
+		}
+	}
+	return enc.EncodeToken(start.End())
+}
+
+// UnmarshalXML implements xml.Unmarshaler interface.
+func (p *Package) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	return decodeNodes(d, start, p)
+}
+
+// MarshalXML implements xml.Marshaler interface.
+func (p Package) MarshalXML(enc *xml.Encoder, start xml.StartElement) error {
+	return encodeNodes(enc, start, &p)
+}
+
+// UnmarshalXML implements xml.Unmarshaler interface.
+func (m *Manifest) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	return decodeNodes(d, start, m)
+}
+
+// MarshalXML implements xml.Marshaler interface.
+func (m Manifest) MarshalXML(enc *xml.Encoder, start xml.StartElement) error {
+	return encodeNodes(enc, start, &m)
+}
+
+// UnmarshalXML implements xml.Unmarshaler interface.
+func (i *Item) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	return decodeNodes(d, start, i)
+}
+
+// MarshalXML implements xml.Marshaler interface.
+func (i Item) MarshalXML(enc *xml.Encoder, start xml.StartElement) error {
+	return encodeNodes(enc, start, &i)
+}
+
+// UnmarshalXML implements xml.Unmarshaler interface.
+func (s *Spine) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	return decodeNodes(d, start, s)
+}
+
+// MarshalXML implements xml.Marshaler interface.
+func (s Spine) MarshalXML(enc *xml.Encoder, start xml.StartElement) error {
+	return encodeNodes(enc, start, &s)
+}
+
+// UnmarshalXML implements xml.Unmarshaler interface.
+func (i *ItemRef) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	return decodeNodes(d, start, i)
+}
+
+// MarshalXML implements xml.Marshaler interface.
+func (i ItemRef) MarshalXML(enc *xml.Encoder, start xml.StartElement) error {
+	return encodeNodes(enc, start, &i)
+}
+
+// UnmarshalXML implements xml.Unmarshaler interface.
+func (c *Collection) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	return decodeNodes(d, start, c)
+}
+
+// MarshalXML implements xml.Marshaler interface.
+func (c Collection) MarshalXML(enc *xml.Encoder, start xml.StartElement) error {
+	return encodeNodes(enc, start, &c)
+}
+
+// UnmarshalXML implements xml.Unmarshaler interface.
+func (g *Guide) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	return decodeNodes(d, start, g)
+}
+
+// MarshalXML implements xml.Marshaler interface.
+func (g Guide) MarshalXML(enc *xml.Encoder, start xml.StartElement) error {
+	return encodeNodes(enc, start, &g)
+}
+
+// UnmarshalXML implements xml.Unmarshaler interface.
+func (r *Reference) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	return decodeNodes(d, start, r)
+}
+
+// MarshalXML implements xml.Marshaler interface.
+func (r Reference) MarshalXML(enc *xml.Encoder, start xml.StartElement) error {
+	return encodeNodes(enc, start, &r)
+}
+
+// MarshalXML implements xml.Marshaler interface.
+func (m Metadata) MarshalXML(enc *xml.Encoder, start xml.StartElement) error {
+	return encodeNodes(enc, start, &m)
+}
+
+// UnmarshalXML implements xml.Unmarshaler interface.
+func (e *Element) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	return decodeNodes(d, start, e)
+}
+
+// MarshalXML implements xml.Marshaler interface.
+func (e Element) MarshalXML(enc *xml.Encoder, start xml.StartElement) error {
+	return encodeNodes(enc, start, &e)
+}
+
+// UnmarshalXML implements xml.Unmarshaler interface.
+func (e *ElementLang) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	return decodeNodes(d, start, e)
+}
+
+// MarshalXML implements xml.Marshaler interface.
+func (e ElementLang) MarshalXML(enc *xml.Encoder, start xml.StartElement) error {
+	return encodeNodes(enc, start, &e)
+}
+
+// UnmarshalXML implements xml.Unmarshaler interface.
+func (m *Meta) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	return decodeNodes(d, start, m)
+}
+
+// MarshalXML implements xml.Marshaler interface.
+func (m Meta) MarshalXML(enc *xml.Encoder, start xml.StartElement) error {
+	return encodeNodes(enc, start, &m)
+}
+
+// UnmarshalXML implements xml.Unmarshaler interface.
+func (l *Link) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	return decodeNodes(d, start, l)
+}
+
+// MarshalXML implements xml.Marshaler interface.
+func (l Link) MarshalXML(enc *xml.Encoder, start xml.StartElement) error {
+	return encodeNodes(enc, start, &l)
+}
@@ -0,0 +1,201 @@
+package epub
+
+import (
+	"path/filepath"
+	"runtime"
+	"time"
+)
+
+// Option describes a publication Writer setting.
+type Option func(*config)
+
+// config holds the publication Writer settings.
+type config struct {
+	contentDir       string           // folder with content of publication
+	packageFilename  string           // package description file name
+	defaultLang      string           // language used if not defined
+	defaultTitle     string           // title used if not defined
+	version          string           // EPUB specification version of the package
+	clock            func() time.Time // source of the publication modification time
+	modTime          time.Time        // fixed modification time of the container files
+	deterministic    bool             // reproducible output mode
+	preserveModified bool             // keep the existing publication modification time
+	warn             func(error)      // warnings handler
+	checkReferences  bool             // check references of packed publication
+	workers          int              // number of parallel workers
+	onProgress       func(Progress)   // progress handler
+	strict           bool             // check XHTML content documents
+	convertHTML      bool             // convert HTML files to XHTML
+	epub2            bool             // add EPUB 2 compatibility data
+}
+
+// newConfig returns the settings with applied options.
+func newConfig(opts []Option) config {
+	cfg := config{
+		contentDir:      "OEBPS",
+		packageFilename: "package.opf",
+		defaultLang:     "en",
+		defaultTitle:    "Untitled",
+		version:         "3.0",
+		clock:           time.Now,
+		warn:            func(error) {},
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return cfg
+}
+
+// WithContentDir sets the name of the folder with content of the publication
+// in the container. The default is “OEBPS”.
+func WithContentDir(dir string) Option {
+	return func(cfg *config) {
+		cfg.contentDir = filepath.ToSlash(dir)
+	}
+}
+
+// WithPackageFilename sets the name of the package document. The default is
+// “package.opf”.
+func WithPackageFilename(name string) Option {
+	return func(cfg *config) {
+		cfg.packageFilename = name
+	}
+}
+
+// WithDefaultLang sets the publication language used if it is not defined in
+// the metadata. The default is “en”.
+func WithDefaultLang(lang string) Option {
+	return func(cfg *config) {
+		cfg.defaultLang = lang
+	}
+}
+
+// WithDefaultTitle sets the publication title used if it is not defined in the
+// metadata. The default is “Untitled”.
+func WithDefaultTitle(title string) Option {
+	return func(cfg *config) {
+		cfg.defaultTitle = title
+	}
+}
+
+// WithVersion sets the EPUB specification version of the package document.
+// The default is “3.0”.
+func WithVersion(version string) Option {
+	return func(cfg *config) {
+		cfg.version = version
+	}
+}
+
+// WithClock sets the function used to get the publication modification time
+// (dcterms:modified).
+func WithClock(clock func() time.Time) Option {
+	return func(cfg *config) {
+		if clock != nil {
+			cfg.clock = clock
+		}
+	}
+}
+
+// WithModTime sets the fixed modification time of all files in the container.
+func WithModTime(t time.Time) Option {
+	return func(cfg *config) {
+		cfg.modTime = t
+	}
+}
+
+// Deterministic enables the reproducible output mode: the same content always
+// produces the same publication bytes. The time t is used as the publication
+// modification time and as the modification time of all files in the container.
+// If the publication identifier is not defined, it is generated from the hash
+// of the publication content instead of random. The item properties are sorted
+// and duplicates are removed.
+func Deterministic(t time.Time) Option {
+	return func(cfg *config) {
+		cfg.clock = func() time.Time { return t }
+		cfg.modTime = t
+		cfg.deterministic = true
+	}
+}
+
+// PreserveModified keeps the existing publication modification time
+// (dcterms:modified) instead of replacing it with the current time. It is
+// useful when re-packaging a publication. The time is set only if it is not
+// defined in the metadata.
+func PreserveModified() Option {
+	return func(cfg *config) {
+		cfg.preserveModified = true
+	}
+}
+
+// OnWarning sets the handler of warnings: problems that do not prevent the
+// creation of the publication, such as malformed language tags or missing
+// metadata replaced with default values.
+func OnWarning(warn func(error)) Option {
+	return func(cfg *config) {
+		if warn != nil {
+			cfg.warn = warn
+		}
+	}
+}
+
+// CheckReferences enables the check of the publication references when the
+// unpacked publication is packed with Pack: the package documents listed in
+// the container and the manifest resources must exist, the spine must refer
+// to the manifest items.
+func CheckReferences() Option {
+	return func(cfg *config) {
+		cfg.checkReferences = true
+	}
+}
+
+// Parallel enables the parallel mode: AddContent reads the content into a
+// temporary buffer or file and passes it to the given number of workers (the
+// number of CPUs if not positive), which compress the files in the background,
+// so even sequential calls are compressed in parallel. AddContent waits only
+// if all workers are busy; compression errors are returned by Close. The files
+// are written to the container sorted by name on Close, and manifest
+// identifiers are assigned in the same order, so the result does not depend
+// on the order of concurrent calls. The workers are stopped by Close or Abort.
+func Parallel(workers int) Option {
+	return func(cfg *config) {
+		if workers <= 0 {
+			workers = runtime.NumCPU()
+		}
+		cfg.workers = workers
+	}
+}
+
+// Strict enables the check of XHTML content documents added with AddContent:
+// the document must be well-formed XML in the XHTML namespace with the title
+// element, must declare the epub namespace if it is used and must not contain
+// obsolete elements or document type declarations with external identifiers.
+// The ContentError is returned and the file is not added if the check fails.
+func Strict() Option {
+	return func(cfg *config) {
+		cfg.strict = true
+	}
+}
+
+// ConvertHTML enables the conversion of HTML files (with the .html or .htm
+// extension) added with AddContent to polyglot XHTML content documents with
+// HTMLToXHTML. The converted files keep their names and are stored with the
+// application/xhtml+xml media type.
+func ConvertHTML() Option {
+	return func(cfg *config) {
+		cfg.convertHTML = true
+	}
+}
+
+// EPUB2Compatible enables the EPUB 2 compatibility of the written publication:
+// on Close the NCX file with the table of contents is added to the spine, the
+// landmarks are duplicated in the guide and the cover image is defined with the
+// cover meta. These constructs are valid in both EPUB 2 and EPUB 3 packages.
+// The role, file-as and scheme of the metadata elements are expressed only as
+// EPUB 3 refinements: the EPUB 2 attributes of the metadata elements are
+// converted to them. The table of contents is generated from the spine if it
+// is not defined with AddTOC.
+func EPUB2Compatible() Option {
+	return func(cfg *config) {
+		cfg.epub2 = true
+	}
+}
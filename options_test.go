@@ -0,0 +1,68 @@
+package epub_test
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+
+	epub "github.com/mdigger/epub3"
+)
+
+func TestWriterOptions(t *testing.T) {
+	tests := []struct {
+		dir, name, lang, title string
+	}{
+		{"OEBPS", "package.opf", "en", "Untitled"},
+		{"EPUB", "content.opf", "ru", "Без названия"},
+		{"book/content", "book.opf", "fr", "Sans titre"},
+	}
+	results := make([][]byte, len(tests))
+	var wg sync.WaitGroup
+	for i, test := range tests {
+		wg.Add(1)
+		go func(i int, dir, name, lang, title string) {
+			defer wg.Done()
+			var buf bytes.Buffer
+			pub, err := epub.New(&buf, epub.WithContentDir(dir), epub.WithPackageFilename(name),
+				epub.WithDefaultLang(lang), epub.WithDefaultTitle(title))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			for _, chapter := range []string{"one.xhtml", "two.xhtml"} {
+				if err := pub.AddContent(strings.NewReader(testDocument(chapter, "Text.")),
+					chapter, epub.Primary); err != nil {
+					t.Error(err)
+				}
+			}
+			if err := pub.Close(); err != nil {
+				t.Error(err)
+			}
+			results[i] = buf.Bytes()
+		}(i, test.dir, test.name, test.lang, test.title)
+	}
+	wg.Wait()
+	if t.Failed() {
+		return
+	}
+
+	for i, test := range tests {
+		full := test.dir + "/" + test.name
+		container := readTestFile(t, results[i], epub.ContainerFilename)
+		if !strings.Contains(container, `full-path="`+full+`"`) {
+			t.Errorf("container does not refer to %s:\n%s", full, container)
+		}
+		pkg, err := epub.ReadPackage(strings.NewReader(readTestFile(t, results[i], full)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pkg.Metadata.Lang() != test.lang {
+			t.Errorf("%s: language = %q, want %q", full, pkg.Metadata.Lang(), test.lang)
+		}
+		if title := pkg.Metadata.Title[0].Value; title != test.title {
+			t.Errorf("%s: title = %q, want %q", full, title, test.title)
+		}
+		readTestFile(t, results[i], test.dir+"/one.xhtml")
+	}
+}
@@ -0,0 +1,232 @@
+package epub
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mdigger/epub3/internal/ocf"
+)
+
+// ContainerFilename is the name of the container file.
+const ContainerFilename = "META-INF/container.xml"
+
+// Pack writes the unpacked publication from the file system, such as
+// os.DirFS(dir), to w as the zip container. The mimetype file is written first
+// uncompressed and without extra fields, followed by the container file and
+// other files in lexical order. Hidden files (with names starting with a dot)
+// are skipped; an error is returned if the manifest refers to them. The
+// CheckReferences option enables the check of publication references before
+// packing. On error w holds the incomplete data that is not a readable
+// publication.
+func Pack(w io.Writer, fsys fs.FS, opts ...Option) error {
+	return pack(w, fsys, newConfig(opts), nil)
+}
+
+// pack writes the publication from the file system to w. The files replace
+// the files of the file system with the same names or are added to the
+// publication.
+func pack(w io.Writer, fsys fs.FS, cfg config, files map[string][]byte) error {
+	// check mimetype file if exists
+	mimetype, err := fs.ReadFile(fsys, "mimetype")
+	switch {
+	case err == nil:
+		if string(bytes.TrimSpace(mimetype)) != "application/epub+zip" {
+			return fmt.Errorf("bad mimetype %q", mimetype)
+		}
+	case !errors.Is(err, fs.ErrNotExist):
+		return err
+	}
+
+	// read container
+	data, err := fs.ReadFile(fsys, ContainerFilename)
+	if err != nil {
+		return err
+	}
+	container, err := ReadContainer(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("%s: %w", ContainerFilename, err)
+	}
+	if cfg.checkReferences {
+		if err := checkReferences(fsys, container); err != nil {
+			return err
+		}
+	}
+	resources, err := manifestFiles(fsys, container, files)
+	if err != nil {
+		return err
+	}
+
+	// the zip writer is not closed on error to not write the central
+	// directory of the incomplete publication
+	sink := newZipSink(w, cfg.modTime)
+
+	// modTime returns the modification time of the file
+	modTime := func(name string) time.Time {
+		if !cfg.modTime.IsZero() {
+			return cfg.modTime
+		}
+		if info, err := fs.Stat(fsys, name); err == nil {
+			return info.ModTime()
+		}
+		return time.Time{}
+	}
+
+	// write mimetype and container files
+	file, err := sink.create("mimetype", modTime("mimetype"))
+	if err != nil {
+		return err
+	}
+	if _, err = io.WriteString(file, "application/epub+zip"); err != nil {
+		return err
+	}
+	if file, err = sink.create(ContainerFilename, modTime(ContainerFilename)); err != nil {
+		return err
+	}
+	if _, err = file.Write(data); err != nil {
+		return err
+	}
+
+	// write other files
+	written := make(map[string]bool, len(files))
+	err = fs.WalkDir(fsys, ".", func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(entry.Name(), ".") && name != "." {
+			// skip hidden files, unless they are publication resources
+			for resource := range resources {
+				if resource == name || strings.HasPrefix(resource, name+"/") {
+					return fmt.Errorf("hidden file %q is referenced by the manifest", resource)
+				}
+			}
+			if entry.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if entry.IsDir() || name == "mimetype" || name == ContainerFilename {
+			return nil
+		}
+		if data, ok := files[name]; ok {
+			written[name] = true
+			file, err := sink.create(name, modTime(name))
+			if err != nil {
+				return err
+			}
+			_, err = file.Write(data)
+			return err
+		}
+		src, err := fsys.Open(name)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+		file, err := sink.create(name, modTime(name))
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(file, src)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	// write added files
+	names := make([]string, 0, len(files))
+	for name := range files {
+		if !written[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	created := cfg.modTime
+	if created.IsZero() {
+		created = cfg.clock()
+	}
+	for _, name := range names {
+		file, err := sink.create(name, created)
+		if err != nil {
+			return err
+		}
+		if _, err = file.Write(files[name]); err != nil {
+			return err
+		}
+	}
+
+	return sink.Close()
+}
+
+// manifestFiles returns the names of the resources listed in the manifests of
+// the publication packages. The packages are read from the files or from the
+// file system.
+func manifestFiles(fsys fs.FS, container *Container, files map[string][]byte) (map[string]bool, error) {
+	resources := make(map[string]bool)
+	for _, rootfile := range container.Rootfiles {
+		resources[rootfile.FullPath] = true
+		data, ok := files[rootfile.FullPath]
+		if !ok {
+			var err error
+			if data, err = fs.ReadFile(fsys, rootfile.FullPath); err != nil {
+				return nil, err
+			}
+		}
+		pkg, err := ReadPackage(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", rootfile.FullPath, err)
+		}
+		root := path.Dir(rootfile.FullPath)
+		for _, item := range pkg.Manifest.Items {
+			if name, ok := ocf.Resolve(root, item.Href); ok {
+				resources[name] = true
+			}
+		}
+	}
+	return resources, nil
+}
+
+// checkReferences checks that the package documents listed in the container
+// and their manifest resources exist and the spine refers to the manifest
+// items.
+func checkReferences(fsys fs.FS, container *Container) error {
+	if len(container.Rootfiles) == 0 {
+		return fmt.Errorf("%s: no rootfile", ContainerFilename)
+	}
+	for _, rootfile := range container.Rootfiles {
+		data, err := fs.ReadFile(fsys, rootfile.FullPath)
+		if err != nil {
+			return err
+		}
+		pkg, err := ReadPackage(bytes.NewReader(data))
+		if err != nil {
+			return fmt.Errorf("%s: %w", rootfile.FullPath, err)
+		}
+		root := path.Dir(rootfile.FullPath)
+		ids := make(map[string]bool, len(pkg.Manifest.Items))
+		for _, item := range pkg.Manifest.Items {
+			ids[item.ID] = true
+			name, ok := ocf.Resolve(root, item.Href)
+			if !ok {
+				continue // remote resource
+			}
+			if _, err := fs.Stat(fsys, name); err != nil {
+				return fmt.Errorf("%s: manifest item %q: %w",
+					rootfile.FullPath, item.Href, err)
+			}
+		}
+		for _, itemref := range pkg.Spine.ItemRefs {
+			if !ids[itemref.IDRef] {
+				return fmt.Errorf("%s: spine item %q is not found in the manifest",
+					rootfile.FullPath, itemref.IDRef)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package epub_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	epub "github.com/mdigger/epub3"
+)
+
+// testContainer is the container file referring to the OEBPS/package.opf.
+const testContainer = `<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+<rootfiles><rootfile full-path="OEBPS/package.opf" media-type="application/oebps-package+xml"/></rootfiles>
+</container>`
+
+// testPackage returns the package document with the manifest items.
+func testPackage(items string) string {
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="uid">
+<metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+<dc:identifier id="uid">urn:uuid:00000000-0000-4000-8000-000000000000</dc:identifier>
+<dc:title>Test</dc:title><dc:language>en</dc:language>
+<meta property="dcterms:modified">2021-03-15T10:20:30Z</meta>
+</metadata>
+<manifest>` + items + `</manifest>
+<spine><itemref idref="chapter"/></spine>
+</package>`
+}
+
+func TestPack(t *testing.T) {
+	chapter := `<item id="chapter" href="chapter.xhtml" media-type="application/xhtml+xml" properties="nav"/>`
+	tests := []struct {
+		name  string
+		files fstest.MapFS
+		err   string
+	}{
+		{"hidden files", fstest.MapFS{
+			"OEBPS/package.opf":   {Data: []byte(testPackage(chapter))},
+			"OEBPS/.DS_Store":     {Data: []byte("junk")},
+			".git/config":         {Data: []byte("junk")},
+			"OEBPS/chapter.xhtml": {Data: []byte(testDocument("Chapter", "Text."))},
+		}, ""},
+		{"referenced hidden file", fstest.MapFS{
+			"OEBPS/package.opf": {Data: []byte(testPackage(chapter +
+				`<item id="style" href=".style.css" media-type="text/css"/>`))},
+			"OEBPS/.style.css":    {Data: []byte("p {}")},
+			"OEBPS/chapter.xhtml": {Data: []byte(testDocument("Chapter", "Text."))},
+		}, `hidden file "OEBPS/.style.css" is referenced by the manifest`},
+		{"referenced file in hidden folder", fstest.MapFS{
+			"OEBPS/package.opf": {Data: []byte(testPackage(chapter +
+				`<item id="style" href=".css/style.css" media-type="text/css"/>`))},
+			"OEBPS/.css/style.css": {Data: []byte("p {}")},
+			"OEBPS/chapter.xhtml":  {Data: []byte(testDocument("Chapter", "Text."))},
+		}, `hidden file "OEBPS/.css/style.css" is referenced by the manifest`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.files[epub.ContainerFilename] = &fstest.MapFile{Data: []byte(testContainer)}
+			var buf bytes.Buffer
+			err := epub.Pack(&buf, test.files)
+			switch {
+			case test.err != "":
+				if err == nil || err.Error() != test.err {
+					t.Errorf("error %v, want %q", err, test.err)
+				}
+				return
+			case err != nil:
+				t.Fatal(err)
+			}
+			zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			for _, file := range zr.File {
+				names = append(names, file.Name)
+			}
+			want := []string{"mimetype", epub.ContainerFilename, "OEBPS/chapter.xhtml", "OEBPS/package.opf"}
+			if len(names) != len(want) {
+				t.Fatalf("files %q, want %q", names, want)
+			}
+			for i := range names {
+				if names[i] != want[i] {
+					t.Errorf("files %q, want %q", names, want)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestPackModTime(t *testing.T) {
+	date := time.Date(2021, 3, 15, 10, 20, 30, 0, time.UTC)
+	files := fstest.MapFS{
+		epub.ContainerFilename: {Data: []byte(testContainer)},
+		"OEBPS/package.opf": {Data: []byte(testPackage(
+			`<item id="chapter" href="chapter.xhtml" media-type="application/xhtml+xml" properties="nav"/>`))},
+		"OEBPS/chapter.xhtml": {Data: []byte(testDocument("Chapter", "Text.")), ModTime: date},
+		"OEBPS/old.css":       {Data: []byte("p {}"), ModTime: time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	var buf bytes.Buffer
+	if err := epub.Pack(&buf, files); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range zr.File {
+		want := date
+		switch file.Name {
+		case "OEBPS/chapter.xhtml":
+		case "OEBPS/old.css":
+			// the times before 1980 can not be stored in the MS-DOS format
+			want = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+		default:
+			continue
+		}
+		if !file.Modified.Equal(want) {
+			t.Errorf("%s: modification time %v, want %v", file.Name, file.Modified, want)
+		}
+	}
+}
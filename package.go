@@ -3,68 +3,217 @@
 package epub
 
 import (
+	"bytes"
 	"encoding/xml"
 )
 
 // Package element is the root container of the Package Document and encapsulates Publication
 // metadata and resource information.
 type Package struct {
-	XMLName          xml.Name    `xml:"http://www.idpf.org/2007/opf package"`
-	Version          string      `xml:"version,attr"`            // Specifies the EPUB specification version to which the Publication conforms
-	UniqueIdentifier string      `xml:"unique-identifier,attr"`  // An IDREF that identifies the dc:identifier element that provides the package's preferred, or primary, identifier
-	Prefix           string      `xml:"prefix,attr,omitempty"`   // Declaration mechanism for prefixes not reserved by this specification.
-	Lang             string      `xml:"xml:lang,attr,omitempty"` // Specifies the language used in the contents and attribute values of the carrying element and its descendants
-	Dir              string      `xml:"dir,attr,omitempty"`      // Specifies the base text direction of the content and attribute values of the carrying element and its descendants.
-	ID               string      `xml:"id,attr,omitempty"`       // The ID of this element, which must be unique within the document scope
-	Metadata         Metadata    `xml:"metadata"`                // The metadata element encapsulates Publication meta information
-	Manifest         Manifest    `xml:"manifest"`                // The manifest element provides an exhaustive list of the Publication Resources that constitute the EPUB Publication, each represented by an item element.
-	Spine            Spine       `xml:"spine"`                   // The spine element defines the default reading order of the EPUB Publication content
-	Collection       *Collection `xml:"collection,omitempty"`    // The collection element defines a related group of resources. (Added in EPUB 301.)
+	XMLName          xml.Name      `xml:"http://www.idpf.org/2007/opf package"`
+	Version          string        `xml:"version,attr"`            // Specifies the EPUB specification version to which the Publication conforms
+	UniqueIdentifier string        `xml:"unique-identifier,attr"`  // An IDREF that identifies the dc:identifier element that provides the package's preferred, or primary, identifier
+	Prefix           string        `xml:"prefix,attr,omitempty"`   // Declaration mechanism for prefixes not reserved by this specification.
+	Lang             string        `xml:"xml:lang,attr,omitempty"` // Specifies the language used in the contents and attribute values of the carrying element and its descendants
+	Dir              string        `xml:"dir,attr,omitempty"`      // Specifies the base text direction of the content and attribute values of the carrying element and its descendants.
+	ID               string        `xml:"id,attr,omitempty"`       // The ID of this element, which must be unique within the document scope
+	Metadata         Metadata      `xml:"metadata"`                // The metadata element encapsulates Publication meta information
+	Manifest         Manifest      `xml:"manifest"`                // The manifest element provides an exhaustive list of the Publication Resources that constitute the EPUB Publication, each represented by an item element.
+	Spine            Spine         `xml:"spine"`                   // The spine element defines the default reading order of the EPUB Publication content
+	Collections      []*Collection `xml:"collection,omitempty"`    // The collection element defines a related group of resources. (Added in EPUB 301.)
+	Guide            *Guide        `xml:"guide,omitempty"`         // EPUB 2: references to the fundamental structural components of the publication.
+	Attrs            []xml.Attr    `xml:",any,attr" json:"-"`
+	Extensions       []Extension   `xml:",any" json:"-"`
 }
 
 // Manifest element provides an exhaustive list of the Publication Resources that constitute
 // the EPUB Publication, each represented by an item element.
 type Manifest struct {
-	ID    string `xml:"id,attr,omitempty"` // The ID [XML] of this element, which must be unique within the document scope.
-	Items []Item `xml:"item"`              // List of the Publication Resources
+	ID         string      `xml:"id,attr,omitempty" json:"id,omitempty"` // The ID [XML] of this element, which must be unique within the document scope.
+	Items      []Item      `xml:"item" json:"items"`                     // List of the Publication Resources
+	Attrs      []xml.Attr  `xml:",any,attr" json:"-"`
+	Extensions []Extension `xml:",any" json:"-"`
 }
 
 // Item element represents a Publication Resource.
 type Item struct {
-	ID           string `xml:"id,attr"`                      // The ID [XML] of this element, which must be unique within the document scope.
-	Href         string `xml:"href,attr"`                    // An IRI [RFC3987] specifying the location of the Publication Resource described by this item.
-	MediaType    string `xml:"media-type,attr"`              // A media type [RFC2046] that specifies the type and format of the Publication Resource described by this item.
-	Fallback     string `xml:"fallback,attr,omitempty"`      // An IDREF [XML] that identifies the fallback for a non-Core Media Type.
-	Properties   string `xml:"properties,attr,omitempty"`    // A space-separated list of property values.
-	MediaOverlay string `xml:"media-overlay,attr,omitempty"` // An IDREF [XML] that identifies the Media Overlay Document for the resource described by this item.
+	ID           string      `xml:"id,attr" json:"id"`                                           // The ID [XML] of this element, which must be unique within the document scope.
+	Href         string      `xml:"href,attr" json:"href"`                                       // An IRI [RFC3987] specifying the location of the Publication Resource described by this item.
+	MediaType    string      `xml:"media-type,attr" json:"media-type"`                           // A media type [RFC2046] that specifies the type and format of the Publication Resource described by this item.
+	Fallback     string      `xml:"fallback,attr,omitempty" json:"fallback,omitempty"`           // An IDREF [XML] that identifies the fallback for a non-Core Media Type.
+	Properties   string      `xml:"properties,attr,omitempty" json:"properties,omitempty"`       // A space-separated list of property values.
+	MediaOverlay string      `xml:"media-overlay,attr,omitempty" json:"media-overlay,omitempty"` // An IDREF [XML] that identifies the Media Overlay Document for the resource described by this item.
+	Attrs        []xml.Attr  `xml:",any,attr" json:"-"`
+	Extensions   []Extension `xml:",any" json:"-"`
 }
 
 // Spine element defines the default reading order of the EPUB Publication content by defining
 // an ordered list of manifest item references.
 type Spine struct {
-	ID            string    `xml:"id,attr,omitempty"`                         // The ID [XML] of this element, which must be unique within the document scope.
-	Toc           string    `xml:"toc,attr,omitempty"`                        // An IDREF [XML] that identifies the manifest item that represents the superseded NCX.
-	PageDirection string    `xml:"page-progression-direction,attr,omitempty"` // The global direction in which the Publication content flows. Allowed values are ltr (left-to-right), rtl (right-to-left) and default.
-	ItemRefs      []ItemRef `xml:"itemref"`                                   // Ordered subset of the Publication Resources listed in the manifest
+	ID            string      `xml:"id,attr,omitempty" json:"id,omitempty"`                                                 // The ID [XML] of this element, which must be unique within the document scope.
+	Toc           string      `xml:"toc,attr,omitempty" json:"toc,omitempty"`                                               // An IDREF [XML] that identifies the manifest item that represents the superseded NCX.
+	PageDirection string      `xml:"page-progression-direction,attr,omitempty" json:"page-progression-direction,omitempty"` // The global direction in which the Publication content flows. Allowed values are ltr (left-to-right), rtl (right-to-left) and default.
+	ItemRefs      []ItemRef   `xml:"itemref" json:"itemrefs"`                                                               // Ordered subset of the Publication Resources listed in the manifest
+	Attrs         []xml.Attr  `xml:",any,attr" json:"-"`
+	Extensions    []Extension `xml:",any" json:"-"`
 }
 
 // ItemRef elements of the spine represent a sequential list of Publication Resources
 // (typically EPUB Content Documents). The order of the itemref elements defines the default
 // reading order of the Publication.
 type ItemRef struct {
-	IDRef      string `xml:"idref,attr"`                // An IDREF [XML] that identifies a manifest item.
-	Linear     string `xml:"linear,attr,omitempty"`     // Specifies whether the referenced content is primary. The value of the attribute must be yes or no. The default value is yes.
-	ID         string `xml:"id,attr,omitempty"`         // The ID [XML] of this element, which must be unique within the document scope.
-	Properties string `xml:"properties,attr,omitempty"` // A space-separated list of property values.
+	IDRef      string      `xml:"idref,attr" json:"idref"`                               // An IDREF [XML] that identifies a manifest item.
+	Linear     string      `xml:"linear,attr,omitempty" json:"linear,omitempty"`         // Specifies whether the referenced content is primary. The value of the attribute must be yes or no. The default value is yes.
+	ID         string      `xml:"id,attr,omitempty" json:"id,omitempty"`                 // The ID [XML] of this element, which must be unique within the document scope.
+	Properties string      `xml:"properties,attr,omitempty" json:"properties,omitempty"` // A space-separated list of property values.
+	Attrs      []xml.Attr  `xml:",any,attr" json:"-"`
+	Extensions []Extension `xml:",any" json:"-"`
 }
 
 // Collection element defines a related group of resources.
 type Collection struct {
-	Lang        string       `xml:"xml:lang,attr,omitempty"` // Specifies the language used in the contents and attribute values of the carrying element and its descendants
-	Dir         string       `xml:"dir,attr,omitempty"`      // Specifies the base text direction of the content and attribute values of the carrying element and its descendants.
-	ID          string       `xml:"id,attr,omitempty"`       // The ID [XML] of this element, which must be unique within the document scope.
-	Role        string       `xml:"role,attr"`               // Specifies the nature of the collection
-	Metadata    *Metadata    `xml:"metadata,omitempty"`      // The optional metadata element child of collection is an adaptation of the package metadata element.
-	Collections []Collection `xml:"collection,omitempty"`    // A collection may define sub-collections through the inclusion of one or more child collection elements.
-	Links       []Link       `xml:"link,omitempty"`          // The link element child of collection is an adaptation of the metadata link element.
+	Lang        string        `xml:"xml:lang,attr,omitempty" json:"lang,omitempty"`     // Specifies the language used in the contents and attribute values of the carrying element and its descendants
+	Dir         string        `xml:"dir,attr,omitempty" json:"dir,omitempty"`           // Specifies the base text direction of the content and attribute values of the carrying element and its descendants.
+	ID          string        `xml:"id,attr,omitempty" json:"id,omitempty"`             // The ID [XML] of this element, which must be unique within the document scope.
+	Role        string        `xml:"role,attr" json:"role"`                             // Specifies the nature of the collection
+	Metadata    *Metadata     `xml:"metadata,omitempty" json:"metadata,omitempty"`      // The optional metadata element child of collection is an adaptation of the package metadata element.
+	Collections []*Collection `xml:"collection,omitempty" json:"collections,omitempty"` // A collection may define sub-collections through the inclusion of one or more child collection elements.
+	Links       []Link        `xml:"link,omitempty" json:"links,omitempty"`             // The link element child of collection is an adaptation of the metadata link element.
+	Attrs       []xml.Attr    `xml:",any,attr" json:"-"`
+	Extensions  []Extension   `xml:",any" json:"-"`
+}
+
+// Guide element of EPUB 2 package identifies the fundamental structural
+// components of the publication. EPUB 3 replaces it with the landmarks of the
+// navigation document.
+type Guide struct {
+	References []Reference `xml:"reference" json:"references"`
+	Attrs      []xml.Attr  `xml:",any,attr" json:"-"`
+	Extensions []Extension `xml:",any" json:"-"`
+}
+
+// Reference element of the guide refers to the structural component of the
+// publication.
+type Reference struct {
+	Type       string      `xml:"type,attr" json:"type"`                       // The type of the component, such as “cover”, “toc” or “text”.
+	Title      string      `xml:"title,attr,omitempty" json:"title,omitempty"` // The title of the component.
+	Href       string      `xml:"href,attr" json:"href"`                       // The reference to the component.
+	Attrs      []xml.Attr  `xml:",any,attr" json:"-"`
+	Extensions []Extension `xml:",any" json:"-"`
+}
+
+// Extension is the XML node not described by the package structures: the
+// element, such as the vendor metadata or the EPUB 3.0 bindings element, or
+// the comment. The package structures keep such nodes in the Extensions field
+// and unknown attributes in the Attrs field, so they are written back when the
+// read package is written. The nodes read from the document are written in
+// the same place: after the known element they followed. The extensions
+// created by the program follow the known elements of the structure.
+//
+// The attributes and content of the extension element are kept as read. If
+// the content has no text, the whitespace between the nested elements is
+// replaced by the indentation; otherwise the content is written as is,
+// without indentation.
+type Extension struct {
+	XMLName xml.Name
+	Attrs   []xml.Attr  // Attributes of the element.
+	Content []xml.Token // Content of the element: text, comments and nested elements.
+	Comment string      // Text of the comment if the node is the comment: XMLName is empty.
+
+	position *nodePosition // position of the node read from the document
+}
+
+// UnmarshalXML implements xml.Unmarshaler interface.
+func (e *Extension) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	e.XMLName, e.Attrs = packageName(start.Name), start.Attr
+	for depth := 0; ; {
+		token, err := d.Token()
+		if err != nil {
+			return err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			depth++
+			t.Name = packageName(t.Name)
+			token = t
+		case xml.EndElement:
+			if depth == 0 {
+				if !e.hasText() {
+					e.dropIndent()
+				}
+				return nil
+			}
+			depth--
+			t.Name = packageName(t.Name)
+			token = t
+		case xml.ProcInst, xml.Directive:
+			continue // not allowed in the package content
+		}
+		e.Content = append(e.Content, xml.CopyToken(token))
+	}
+}
+
+// hasText returns true if the content of the element has text other than
+// whitespace.
+func (e *Extension) hasText() bool {
+	for _, token := range e.Content {
+		if text, ok := token.(xml.CharData); ok && len(bytes.TrimSpace(text)) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// dropIndent removes the whitespace between the nested elements.
+func (e *Extension) dropIndent() {
+	content := e.Content[:0]
+	for _, token := range e.Content {
+		if _, ok := token.(xml.CharData); !ok {
+			content = append(content, token)
+		}
+	}
+	e.Content = content
+}
+
+// packageName returns the element name without the package namespace, which
+// is the default namespace of the package document.
+func packageName(name xml.Name) xml.Name {
+	if name.Space == nsOPF {
+		name.Space = ""
+	}
+	return name
+}
+
+// MarshalXML implements xml.Marshaler interface.
+func (e Extension) MarshalXML(enc *xml.Encoder, start xml.StartElement) error {
+	if e.XMLName.Local == "" {
+		return enc.EncodeToken(xml.Comment(e.Comment))
+	}
+	start = xml.StartElement{Name: e.XMLName, Attr: e.Attrs}
+	if e.hasText() {
+		// the indentation would change the text, so the content is written
+		// as is with the separate encoder
+		var buf bytes.Buffer
+		content := xml.NewEncoder(&buf)
+		for _, token := range e.Content {
+			if err := content.EncodeToken(token); err != nil {
+				return err
+			}
+		}
+		if err := content.Flush(); err != nil {
+			return err
+		}
+		return enc.EncodeElement(struct {
+			Content []byte `xml:",innerxml"`
+		}{buf.Bytes()}, start)
+	}
+	if err := enc.EncodeToken(start); err != nil {
+		return err
+	}
+	for _, token := range e.Content {
+		if err := enc.EncodeToken(token); err != nil {
+			return err
+		}
+	}
+	return enc.EncodeToken(start.End())
 }
@@ -0,0 +1,125 @@
+package epub_test
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	epub "github.com/mdigger/epub3"
+)
+
+const testExtensionsPackage = `<?xml version="1.0" encoding="UTF-8"?>
+<!-- package comment -->
+<package xmlns="http://www.idpf.org/2007/opf" xmlns:v="http://example.com/vendor"
+  version="3.0" unique-identifier="pub-id" v:build="42">
+<!-- first comment --><!-- second comment -->
+<metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+<!-- metadata comment -->
+<dc:identifier id="pub-id">urn:uuid:a5e1a3a4-8a3e-4c7e-9a7c-5b1c2c3d4e5f</dc:identifier>
+<dc:title>Title</dc:title>
+<!-- title comment -->
+<v:series>Series</v:series>
+<dc:language>en</dc:language>
+<meta property="dcterms:modified">2020-01-02T03:04:05Z</meta>
+<v:record v:id="1"> Mixed  <v:b>text</v:b> kept <!-- extension comment --></v:record>
+</metadata>
+<manifest>
+<!-- manifest comment -->
+<item id="text" href="text.xhtml" media-type="application/xhtml+xml" v:checked="yes"/>
+<!-- item comment -->
+<item id="notes" href="notes.xhtml" media-type="application/xhtml+xml"/>
+</manifest>
+<spine><itemref idref="text"/><!-- spine comment --><itemref idref="notes"/></spine>
+<bindings><mediaType media-type="application/x-demo" handler="text"/></bindings>
+</package>`
+
+func TestPackageExtensions(t *testing.T) {
+	pkg, err := epub.ReadPackage(strings.NewReader(testExtensionsPackage))
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := xml.MarshalIndent(pkg, "", "\t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reread, err := epub.ReadPackage(bytes.NewReader(first))
+	if err != nil {
+		t.Fatalf("%v:\n%s", err, first)
+	}
+	second, err := xml.MarshalIndent(reread, "", "\t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(first, second) {
+		t.Errorf("package is changed on the second round-trip:\n%s\n%s", first, second)
+	}
+
+	out := string(first)
+	for _, want := range []string{
+		`> Mixed  <`,
+		`> kept <!-- extension comment --></`,
+		`checked="yes"`,
+		`build="42"`,
+		`media-type="application/x-demo"`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("package does not contain %s:\n%s", want, out)
+		}
+	}
+	// comments and extensions are written in the same order
+	var last int
+	for _, want := range []string{
+		"<!-- first comment -->",
+		"<!-- second comment -->",
+		"<metadata",
+		"<!-- metadata comment -->",
+		"<dc:identifier",
+		"<dc:title>",
+		"<!-- title comment -->",
+		">Series</series>",
+		"<dc:language>",
+		"<meta ",
+		"<record",
+		"</metadata>",
+		"<!-- manifest comment -->",
+		`<item id="text"`,
+		"<!-- item comment -->",
+		`<item id="notes"`,
+		`<itemref idref="text"`,
+		"<!-- spine comment -->",
+		`<itemref idref="notes"`,
+		"</spine>",
+		"<bindings>",
+	} {
+		i := strings.Index(out[last:], want)
+		if i < 0 {
+			t.Fatalf("package does not contain %s after the position %d:\n%s", want, last, out)
+		}
+		last += i + len(want)
+	}
+}
+
+func TestPackageNewExtensions(t *testing.T) {
+	pkg, err := epub.ReadPackage(strings.NewReader(testExtensionsPackage))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the added elements and extensions follow the read nodes
+	pkg.Metadata.Meta = append(pkg.Metadata.Meta, epub.Meta{Property: "dcterms:creator", Value: "Added"})
+	pkg.Metadata.Extensions = append(pkg.Metadata.Extensions,
+		epub.Extension{XMLName: xml.Name{Local: "v:added"}}, epub.Extension{Comment: " added "})
+	out, err := xml.Marshal(pkg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `<meta property="dcterms:modified">2020-01-02T03:04:05Z</meta>` +
+		`<record xmlns="http://example.com/vendor" v:id="1">`
+	if !strings.Contains(string(out), want) {
+		t.Errorf("package does not contain %s:\n%s", want, out)
+	}
+	want = `<meta property="dcterms:creator">Added</meta><v:added></v:added><!-- added --></metadata>`
+	if !strings.Contains(string(out), want) {
+		t.Errorf("package does not contain %s:\n%s", want, out)
+	}
+}
@@ -0,0 +1,243 @@
+package epub
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"context"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path"
+	"sort"
+)
+
+// spoolLimit is the size of the data kept in memory before it is moved to the
+// temporary file.
+const spoolLimit = 4 << 20
+
+// spool is the temporary storage of the file contents.
+type spool struct {
+	buf  bytes.Buffer
+	file *os.File
+	size int64
+}
+
+// Write implements io.Writer interface.
+func (s *spool) Write(p []byte) (int, error) {
+	if s.file == nil && s.buf.Len()+len(p) > spoolLimit {
+		// move data to the temporary file
+		file, err := os.CreateTemp("", "epub-*")
+		if err != nil {
+			return 0, err
+		}
+		s.file = file
+		if _, err := s.buf.WriteTo(file); err != nil {
+			return 0, err
+		}
+	}
+	var (
+		n   int
+		err error
+	)
+	if s.file != nil {
+		n, err = s.file.Write(p)
+	} else {
+		n, err = s.buf.Write(p)
+	}
+	s.size += int64(n)
+	return n, err
+}
+
+// WriteTo implements io.WriterTo interface.
+func (s *spool) WriteTo(w io.Writer) (int64, error) {
+	if s.file == nil {
+		return s.buf.WriteTo(w)
+	}
+	if _, err := s.file.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	return io.Copy(w, s.file)
+}
+
+// Close removes the temporary file.
+func (s *spool) Close() error {
+	if s.file == nil {
+		return nil
+	}
+	s.file.Close()
+	return os.Remove(s.file.Name())
+}
+
+// pendingFile is the publication file prepared in parallel mode and written
+// to the sink on Close.
+type pendingFile struct {
+	rendition *Rendition // rendition of the file
+	href      string     // name in the rendition
+	name      string     // name in the container
+	data      *spool     // compressed or raw contents
+	header    *zip.FileHeader
+}
+
+// addPending prepares the file contents in parallel mode: the data is read to
+// the temporary storage and passed to the workers, which compress it; the file
+// is written to the sink on Close.
+func (r *Rendition) addPending(ctx context.Context, content io.Reader, name, mediaType string, ct ContentType, properties []string) error {
+	w := r.writer
+	w.mu.Lock()
+	err := w.failed
+	switch {
+	case err != nil:
+	case w.jobs == nil:
+		err = errors.New("publication is closed")
+	default:
+		err = r.register(name, mediaType, ct, properties)
+	}
+	w.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	// the content is read in the calling goroutine, because the reader may be
+	// used by the caller after return
+	file := &pendingFile{rendition: r, href: name, name: path.Join(r.root, name), data: new(spool)}
+	digest, err := r.copyContent(ctx, file.data, content, file.name)
+	w.mu.Lock()
+	if err != nil {
+		file.data.Close()
+		r.unregister(name)
+		w.mu.Unlock()
+		return err
+	}
+	if digest != nil {
+		r.digests[name] = digest
+	}
+	_, compress := w.sink.(*zipSink)
+	if compress {
+		w.wg.Add(1)
+	} else {
+		w.pending = append(w.pending, file) // written without compression
+	}
+	jobs := w.jobs
+	w.mu.Unlock()
+	if compress {
+		jobs <- file // wait for a free worker
+	}
+	return nil
+}
+
+// startWorkers starts the given number of workers compressing the files.
+func (w *Writer) startWorkers(workers int) {
+	w.jobs = make(chan *pendingFile)
+	for i := 0; i < workers; i++ {
+		go func(jobs <-chan *pendingFile) {
+			for file := range jobs {
+				err := w.compress(file)
+				w.mu.Lock()
+				if err != nil {
+					file.data.Close()
+					file.rendition.unregister(file.href)
+					if w.failed == nil {
+						w.failed = fmt.Errorf("%s: %w", file.name, err)
+					}
+				} else {
+					w.pending = append(w.pending, file)
+				}
+				w.mu.Unlock()
+				w.wg.Done()
+			}
+		}(w.jobs)
+	}
+}
+
+// stopWorkers waits for the files passed to the workers and stops them.
+func (w *Writer) stopWorkers() {
+	w.wg.Wait()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.jobs != nil {
+		close(w.jobs)
+		w.jobs = nil
+	}
+}
+
+// compress replaces the raw contents of the file with the data compressed with
+// the same level as zip.Writer and sets the header of the archive file.
+func (w *Writer) compress(file *pendingFile) error {
+	raw := file.data
+	defer raw.Close()
+	file.data = new(spool)
+	hash := crc32.NewIEEE()
+	compressor, err := flate.NewWriter(file.data, 5)
+	if err != nil {
+		return err
+	}
+	counter := &countWriter{w: io.MultiWriter(compressor, hash)}
+	if _, err := raw.WriteTo(counter); err != nil {
+		return err
+	}
+	if err := compressor.Close(); err != nil {
+		return err
+	}
+	sink := w.sink.(*zipSink)
+	file.header = sink.header(file.name, sink.modTime)
+	file.header.CRC32 = hash.Sum32()
+	file.header.UncompressedSize64 = uint64(counter.n)
+	file.header.CompressedSize64 = uint64(file.data.size)
+	return nil
+}
+
+// writePending stops the parallel workers and writes the prepared files to
+// the sink sorted by name.
+func (w *Writer) writePending(ctx context.Context) error {
+	w.stopWorkers()
+	if w.failed != nil {
+		return w.failed
+	}
+	pending := w.pending
+	w.pending = nil
+	defer func() {
+		for _, file := range pending {
+			file.data.Close()
+		}
+	}()
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].name < pending[j].name
+	})
+	for _, file := range pending {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		var (
+			dst io.Writer
+			err error
+		)
+		if file.header != nil {
+			dst, err = w.sink.(*zipSink).CreateRaw(file.header)
+		} else {
+			dst, err = w.sink.Create(file.name)
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := file.data.WriteTo(dst); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// countWriter counts the number of written bytes.
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+// Write implements io.Writer interface.
+func (c *countWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
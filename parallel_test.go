@@ -0,0 +1,55 @@
+package epub_test
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	epub "github.com/mdigger/epub3"
+)
+
+func TestParallelSequential(t *testing.T) {
+	var buf bytes.Buffer
+	pub, err := epub.New(&buf, epub.Parallel(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub.AddTitle("Parallel")
+	// the same reader is reused: the content must be read before return
+	content := new(strings.Reader)
+	const count = 20
+	for i := 0; i < count; i++ {
+		content.Reset(testDocument(fmt.Sprint("Chapter ", i), strings.Repeat("Text. ", i*1000)))
+		if err := pub.AddContent(content, fmt.Sprintf("chapter%02d.xhtml", i), epub.Primary); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := pub.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < count; i++ {
+		want := testDocument(fmt.Sprint("Chapter ", i), strings.Repeat("Text. ", i*1000))
+		if got := readTestFile(t, buf.Bytes(), fmt.Sprintf("OEBPS/chapter%02d.xhtml", i)); got != want {
+			t.Errorf("chapter %d content differs", i)
+		}
+	}
+	pkg := readTestFile(t, buf.Bytes(), "OEBPS/package.opf")
+	if !strings.Contains(pkg, `<itemref idref="id01"></itemref>`) {
+		t.Errorf("spine is not renumbered:\n%s", pkg)
+	}
+}
+
+func TestParallelAfterClose(t *testing.T) {
+	var buf bytes.Buffer
+	pub, err := epub.New(&buf, epub.Parallel(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pub.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := pub.AddContent(strings.NewReader("text"), "late.txt", epub.Media); err == nil {
+		t.Error("content is added after Close")
+	}
+}
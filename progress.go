@@ -0,0 +1,68 @@
+package epub
+
+import (
+	"context"
+	"io"
+	"sync/atomic"
+)
+
+// Progress describes the progress of writing the publication.
+type Progress struct {
+	Name    string // Name of the container file.
+	Written int64  // Number of bytes of the file written.
+	Total   int64  // Total number of bytes of all files written.
+}
+
+// WithProgress sets the function called when the data of the publication file
+// is written. In parallel mode the function may be called from several
+// goroutines at the same time.
+func WithProgress(progress func(Progress)) Option {
+	return func(cfg *config) {
+		cfg.onProgress = progress
+	}
+}
+
+// progress returns the Writer reporting the progress of writing the
+// container file with the given name.
+func (w *Writer) progress(dst io.Writer, name string) io.Writer {
+	if w.onProgress == nil {
+		return dst
+	}
+	return &progressWriter{w: dst, name: name, writer: w}
+}
+
+// progressWriter reports the progress of writing the file.
+type progressWriter struct {
+	w       io.Writer
+	name    string
+	written int64
+	writer  *Writer
+}
+
+// Write implements io.Writer interface.
+func (p *progressWriter) Write(data []byte) (int, error) {
+	n, err := p.w.Write(data)
+	if n > 0 {
+		p.written += int64(n)
+		p.writer.onProgress(Progress{
+			Name:    p.name,
+			Written: p.written,
+			Total:   atomic.AddInt64(&p.writer.written, int64(n)),
+		})
+	}
+	return n, err
+}
+
+// contextReader stops reading when the context is done.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+// Read implements io.Reader interface.
+func (c *contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
@@ -0,0 +1,101 @@
+package epub_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	epub "github.com/mdigger/epub3"
+)
+
+// cancelReader cancels the context after the first read.
+type cancelReader struct {
+	r      io.Reader
+	cancel context.CancelFunc
+}
+
+func (c *cancelReader) Read(p []byte) (int, error) {
+	defer c.cancel()
+	return c.r.Read(p[:min(len(p), 10)])
+}
+
+func TestProgress(t *testing.T) {
+	var (
+		buf      bytes.Buffer
+		progress []epub.Progress
+	)
+	pub, err := epub.New(&buf, epub.WithProgress(func(p epub.Progress) {
+		progress = append(progress, p)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub.AddTitle("Test")
+	content := testDocument("Chapter", "Text.")
+	if err := pub.AddContent(strings.NewReader(content), "chapter.xhtml", epub.Primary); err != nil {
+		t.Fatal(err)
+	}
+	if err := pub.Close(); err != nil {
+		t.Fatal(err)
+	}
+	var chapter, total int64
+	for _, p := range progress {
+		if p.Total <= total {
+			t.Errorf("total %d is not increased", p.Total)
+		}
+		total = p.Total
+		if p.Name == "OEBPS/chapter.xhtml" {
+			chapter = p.Written
+		}
+	}
+	if chapter != int64(len(content)) {
+		t.Errorf("written %d bytes of chapter, want %d", chapter, len(content))
+	}
+	if names := progress[len(progress)-1].Name; names != epub.ContainerFilename {
+		t.Errorf("last file %q", names)
+	}
+}
+
+func TestAddContentCanceled(t *testing.T) {
+	for _, opts := range [][]epub.Option{nil, {epub.Parallel(2)}} {
+		var buf bytes.Buffer
+		pub, err := epub.New(&buf, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pub.AddTitle("Test")
+		ctx, cancel := context.WithCancel(context.Background())
+		err = pub.AddContentContext(ctx, &cancelReader{
+			r:      strings.NewReader(testDocument("Chapter", "Text.")),
+			cancel: cancel,
+		}, "chapter.xhtml", epub.Primary)
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("error %v, want context.Canceled", err)
+		}
+		err = pub.AddContent(strings.NewReader(testDocument("Chapter", "Text.")),
+			"other.xhtml", epub.Primary)
+		if len(opts) == 0 {
+			// the incomplete file is in the publication
+			if !errors.Is(err, context.Canceled) {
+				t.Errorf("AddContent error %v, want context.Canceled", err)
+			}
+			if err := pub.Close(); !errors.Is(err, context.Canceled) {
+				t.Errorf("Close error %v, want context.Canceled", err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := pub.Close(); err != nil {
+			t.Fatal(err)
+		}
+		pkg := readTestFile(t, buf.Bytes(), "OEBPS/package.opf")
+		if strings.Contains(pkg, "chapter.xhtml") || !strings.Contains(pkg, "other.xhtml") {
+			t.Errorf("canceled file in the package:\n%s", pkg)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package epub
+
+import (
+	"encoding/xml"
+	"io"
+)
+
+// Namespaces used in publication documents.
+const (
+	nsOPF = "http://www.idpf.org/2007/opf"
+	nsDC  = "http://purl.org/dc/elements/1.1/"
+	nsXML = "http://www.w3.org/XML/1998/namespace"
+)
+
+// prefixes holds the prefixes used in the structure tags for known namespaces.
+var prefixes = map[string]string{
+	nsDC:        "dc",
+	nsOPF:       "opf",
+	nsXML:       "xml",
+	nsRendition: "rendition",
+}
+
+// ReadPackage parses the publication package document.
+func ReadPackage(r io.Reader) (*Package, error) {
+	pkg := new(Package)
+	if err := newDecoder(r).Decode(pkg); err != nil {
+		return nil, err
+	}
+	return pkg, nil
+}
+
+// ReadContainer parses the container file (META-INF/container.xml).
+func ReadContainer(r io.Reader) (*Container, error) {
+	container := new(Container)
+	if err := newDecoder(r).Decode(container); err != nil {
+		return nil, err
+	}
+	return container, nil
+}
+
+// newDecoder returns the XML decoder that converts names of elements and
+// attributes to the form used in the structure tags: elements of the package
+// namespace keep the namespace, other known namespaces are replaced by the
+// prefixes, such as “dc:title” or “xml:lang”.
+func newDecoder(r io.Reader) *xml.Decoder {
+	return xml.NewTokenDecoder(&prefixReader{
+		d:  xml.NewDecoder(r),
+		ns: []map[string]string{{"xml": nsXML}},
+	})
+}
+
+// prefixReader converts names of XML elements and attributes.
+type prefixReader struct {
+	d     *xml.Decoder
+	ns    []map[string]string // stack of namespace declarations
+	raw   []xml.Name          // stack of source element names
+	names []xml.Name          // stack of converted element names
+}
+
+// Token implements xml.TokenReader interface.
+func (p *prefixReader) Token() (xml.Token, error) {
+	token, err := p.d.RawToken()
+	if err != nil {
+		return nil, err
+	}
+	switch t := token.(type) {
+	case xml.StartElement:
+		// collect namespace declarations
+		ns := make(map[string]string, len(p.ns[len(p.ns)-1])+1)
+		for prefix, url := range p.ns[len(p.ns)-1] {
+			ns[prefix] = url
+		}
+		attrs := make([]xml.Attr, 0, len(t.Attr))
+		for _, attr := range t.Attr {
+			switch {
+			case attr.Name.Space == "" && attr.Name.Local == "xmlns":
+				ns[""] = attr.Value
+				continue // resolved here
+			case attr.Name.Space == "xmlns":
+				ns[attr.Name.Local] = attr.Value
+			}
+			attrs = append(attrs, attr)
+		}
+		p.ns = append(p.ns, ns)
+		// convert names
+		for i, attr := range attrs {
+			attrs[i].Name = p.attrName(attr.Name)
+		}
+		t.Attr = attrs
+		p.raw = append(p.raw, t.Name)
+		t.Name = p.elementName(t.Name)
+		p.names = append(p.names, t.Name)
+		return t, nil
+	case xml.EndElement:
+		// RawToken does not verify that the start and end elements match
+		last := len(p.names) - 1
+		if last < 0 || p.raw[last] != t.Name {
+			return nil, &xml.SyntaxError{
+				Msg: "unexpected end element </" + t.Name.Local + ">",
+			}
+		}
+		t.Name = p.names[last]
+		p.raw, p.names = p.raw[:last], p.names[:last]
+		p.ns = p.ns[:len(p.ns)-1]
+		return t, nil
+	default:
+		return token, nil
+	}
+}
+
+// elementName returns the converted element name.
+func (p *prefixReader) elementName(name xml.Name) xml.Name {
+	url, ok := p.ns[len(p.ns)-1][name.Space]
+	switch {
+	case !ok && name.Space != "":
+		// undeclared prefix
+		return xml.Name{Local: name.Space + ":" + name.Local}
+	case url == "" || url == nsOPF:
+		return xml.Name{Space: url, Local: name.Local}
+	case prefixes[url] != "":
+		return xml.Name{Local: prefixes[url] + ":" + name.Local}
+	default:
+		return xml.Name{Space: url, Local: name.Local}
+	}
+}
+
+// attrName returns the converted attribute name.
+func (p *prefixReader) attrName(name xml.Name) xml.Name {
+	if name.Space == "" {
+		return name
+	}
+	if name.Space != "xmlns" {
+		if prefix := prefixes[p.ns[len(p.ns)-1][name.Space]]; prefix != "" {
+			return xml.Name{Local: prefix + ":" + name.Local}
+		}
+	}
+	return xml.Name{Local: name.Space + ":" + name.Local}
+}
@@ -0,0 +1,487 @@
+package epub
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Rendition describes one rendering of the publication content: the package
+// with metadata, resources and reading order. The publication has the default
+// rendition and may contain several additional ones, such as reflowable and
+// fixed-layout renditions of the same content.
+type Rendition struct {
+	Metadata
+	Selection   Selection     // rendition selection attributes
+	writer      *Writer       // publication writer
+	root        string        // folder with content of rendition
+	manifest    []Item        // list of the rendition resources
+	spine       []ItemRef     // reading order of the rendition
+	collections []*Collection // top-level collections of the package
+	toc         []*NavPoint   // table of contents of the navigation document
+	landmarks   []Landmark    // landmarks of the navigation document
+	counter     uint
+	digests     map[string][]byte // content hashes for the deterministic identifier
+}
+
+// newRendition returns new publication rendition with content in the root
+// folder and adds it to the publication.
+func (w *Writer) newRendition(root string, selection Selection) *Rendition {
+	rendition := &Rendition{
+		Selection: selection,
+		writer:    w,
+		root:      root,
+		manifest:  make([]Item, 0, 20),
+		spine:     make([]ItemRef, 0, 20),
+	}
+	if w.deterministic {
+		rendition.digests = make(map[string][]byte)
+	}
+	w.renditions = append(w.renditions, rendition)
+	return rendition
+}
+
+// AddRendition adds new rendition of the publication with content in the root
+// folder of the container. The selection attributes allow reading systems to
+// choose the rendition most appropriate for the user. The identifier, title and
+// language of the rendition are taken from the default rendition on Close if
+// they are not defined, so all renditions share the publication identifier.
+func (w *Writer) AddRendition(root string, selection Selection) (*Rendition, error) {
+	root = filepath.ToSlash(root) // normalize folder name
+	for _, rendition := range w.renditions {
+		if rendition.root == root {
+			return nil, fmt.Errorf("a rendition with the folder %q has already been added to the publication", root)
+		}
+	}
+	return w.newRendition(root, selection), nil
+}
+
+// ContentType describe type of content file.
+type ContentType byte
+
+// Supported types of content file.
+const (
+	Primary   ContentType = iota // Primary content file
+	Auxiliary                    // Auxiliary content file
+	Media                        // Media file
+)
+
+// AddContent adds data to the publication. It is safe to call AddContent from
+// several goroutines; with the Parallel option the content is also compressed
+// in parallel. The spine order is the order of AddContent calls, so content
+// documents should be added sequentially.
+func (r *Rendition) AddContent(content io.Reader, name string, ct ContentType, properties ...string) error {
+	return r.AddContentContext(context.Background(), content, name, ct, properties...)
+}
+
+// AddContentContext is like AddContent but stops copying the content and
+// returns the context error when the context is done. If the copying of the
+// content fails, the file is not added; without the Parallel option the
+// partially written file can not be removed from the publication, so the
+// following AddContent and Close calls return the error.
+func (r *Rendition) AddContentContext(ctx context.Context, content io.Reader, name string, ct ContentType, properties ...string) error {
+	name = filepath.ToSlash(name) // normalize file name
+	mediaType := typeByName(name)
+	if ext := strings.ToLower(path.Ext(name)); r.writer.convertHTML &&
+		(ext == ".html" || ext == ".htm") {
+		var buf bytes.Buffer
+		if err := HTMLToXHTML(&buf, &contextReader{ctx: ctx, r: content}); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		content, mediaType = &buf, "application/xhtml+xml"
+	}
+	return r.addContent(ctx, content, name, mediaType, ct, properties)
+}
+
+// addContent adds data with the given media type to the publication.
+func (r *Rendition) addContent(ctx context.Context, content io.Reader, name, mediaType string, ct ContentType, properties []string) error {
+	w := r.writer
+	if w.strict && mediaType == "application/xhtml+xml" {
+		// check the document before it is added to the publication
+		data, err := io.ReadAll(&contextReader{ctx: ctx, r: content})
+		if err != nil {
+			return err
+		}
+		if err := checkXHTML(path.Join(r.root, name), data); err != nil {
+			return err
+		}
+		content = bytes.NewReader(data)
+	}
+	if w.workers > 0 {
+		return r.addPending(ctx, content, name, mediaType, ct, properties)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.failed != nil {
+		return w.failed
+	}
+	if err := r.register(name, mediaType, ct, properties); err != nil {
+		return err
+	}
+
+	// write file to publication
+	file, err := w.sink.Create(path.Join(r.root, name))
+	if err != nil {
+		r.unregister(name)
+		return err
+	}
+	digest, err := r.copyContent(ctx, file, content, path.Join(r.root, name))
+	if err != nil {
+		// the sink contains the incomplete file: the publication can not be
+		// completed
+		r.unregister(name)
+		w.failed = fmt.Errorf("%s: %w", path.Join(r.root, name), err)
+		return err
+	}
+	if digest != nil {
+		r.digests[name] = digest
+	}
+	return nil
+}
+
+// register adds the file to the manifest and, if it is content file, to the
+// spine.
+func (r *Rendition) register(name, mediaType string, ct ContentType, properties []string) error {
+	// check if already added
+	if inManifest(r.manifest, name) {
+		return fmt.Errorf("a file with the name %q has already been added to the publication", name)
+	}
+
+	// generate file id and add to manifest
+	r.counter++
+	id := fmt.Sprintf("id%02x", r.counter)
+	r.manifest = append(r.manifest, Item{
+		ID:         id,
+		Href:       name,
+		MediaType:  mediaType,
+		Properties: r.joinProperties(properties),
+	})
+
+	// if it content file than add to spine
+	if ct < Media {
+		itemref := ItemRef{IDRef: id}
+		if ct == Auxiliary {
+			itemref.Linear = "no"
+		}
+		r.spine = append(r.spine, itemref)
+	}
+	return nil
+}
+
+// unregister removes the file from the manifest and the spine.
+func (r *Rendition) unregister(name string) {
+	for i, item := range r.manifest {
+		if item.Href != name {
+			continue
+		}
+		r.manifest = append(r.manifest[:i], r.manifest[i+1:]...)
+		for j, itemref := range r.spine {
+			if itemref.IDRef == item.ID {
+				r.spine = append(r.spine[:j], r.spine[j+1:]...)
+				break
+			}
+		}
+		return
+	}
+}
+
+// copyContent copies the content of the container file with the given name to
+// dst and reports the progress. In deterministic mode it returns the content
+// hash used for the publication identifier.
+func (r *Rendition) copyContent(ctx context.Context, dst io.Writer, content io.Reader, name string) ([]byte, error) {
+	content = &contextReader{ctx: ctx, r: content}
+	dst = r.writer.progress(dst, name)
+	if r.digests == nil {
+		_, err := io.Copy(dst, content)
+		return nil, err
+	}
+
+	// calculate content hash for the deterministic identifier
+	hash := sha256.New()
+	if _, err := io.Copy(dst, io.TeeReader(content, hash)); err != nil {
+		return nil, err
+	}
+	return hash.Sum(nil), nil
+}
+
+// renumber sorts the manifest items by name and assigns them new identifiers,
+// so that the identifiers do not depend on the order of concurrent AddContent
+// calls.
+func (r *Rendition) renumber() {
+	sort.SliceStable(r.manifest, func(i, j int) bool {
+		return r.manifest[i].Href < r.manifest[j].Href
+	})
+	ids := make(map[string]string, len(r.manifest))
+	for i, item := range r.manifest {
+		id := fmt.Sprintf("id%02x", i+1)
+		ids[item.ID] = id
+		r.manifest[i].ID = id
+	}
+	for i, itemref := range r.spine {
+		r.spine[i].IDRef = ids[itemref.IDRef]
+	}
+}
+
+// build returns the rendition package with the completed metadata and
+// generates the navigation document if needed. The identifier, title and
+// language not defined in the rendition metadata are copied from the defaults.
+func (r *Rendition) build(ctx context.Context, defaults *Metadata) (*Package, error) {
+	metadata := r.Metadata // copy metadata
+	if defaults != nil {
+		if len(metadata.Identifier) == 0 {
+			metadata.Identifier = defaults.Identifier
+		}
+		if len(metadata.Title) == 0 {
+			metadata.Title = defaults.Title
+		}
+		if len(metadata.Language) == 0 {
+			metadata.Language = defaults.Language
+		}
+	}
+	// add DC namespace if not defined
+	if metadata.DC == "" {
+		metadata.DC = nsDC
+	}
+
+	// set global publication UID
+	var uid string
+	for _, item := range metadata.Identifier {
+		if item.ID != "" {
+			uid = item.ID
+			break
+		}
+	}
+	if uid == "" {
+		// UID not defined
+		id := NewUUID()
+		if r.writer.deterministic {
+			id = r.contentUUID()
+		}
+		metadata.Identifier = append(metadata.Identifier,
+			Element{ID: "uuid", Value: id})
+		uid = "uuid"
+	}
+
+	// set modified time
+	modified := -1
+	for i, item := range metadata.Meta {
+		if item.Property == "dcterms:modified" && item.Refines == "" {
+			modified = i
+			break
+		}
+	}
+	switch {
+	case modified < 0:
+		// modified time not set
+		metadata.Meta = append(metadata.Meta, Meta{
+			Property: "dcterms:modified",
+			Value:    r.writer.now(),
+		})
+	case r.writer.preserveModified || metadata.modified:
+		// keep the existing or explicitly set modified time
+		if err := checkModified(metadata.Meta[modified].Value); err != nil {
+			return nil, err
+		}
+	default:
+		// copy meta list to not change the Writer metadata
+		metadata.Meta = append([]Meta(nil), metadata.Meta...)
+		metadata.Meta[modified].Value = r.writer.now()
+	}
+
+	// add default language if not defined
+	if len(metadata.Language) == 0 {
+		r.writer.warn(fmt.Errorf("publication language is not defined, %q is used",
+			r.writer.defaultLang))
+		metadata.Language = []Element{{Value: r.writer.defaultLang}}
+	}
+	for _, err := range metadata.CheckLang() {
+		r.writer.warn(err)
+	}
+
+	// add default title if not defined
+	if len(metadata.Title) == 0 {
+		metadata.Title = []ElementLang{{Value: r.writer.defaultTitle}}
+	}
+
+	// add rendition layout if not defined
+	if r.Selection.Layout != "" {
+		var layout bool
+		for _, item := range metadata.Meta {
+			if item.Property == "rendition:layout" && item.Refines == "" {
+				layout = true
+				break
+			}
+		}
+		if !layout {
+			metadata.Meta = append(metadata.Meta, Meta{
+				Property: "rendition:layout",
+				Value:    r.Selection.Layout,
+			})
+		}
+	}
+
+	// generate navigation document
+	if err := r.addNav(ctx, &metadata); err != nil {
+		return nil, err
+	}
+
+	// generate EPUB 2 navigation control file
+	if r.writer.epub2 {
+		if err := r.addNCX(ctx, &metadata, uid); err != nil {
+			return nil, err
+		}
+	}
+
+	// check metadata links & collections
+	if err := checkMetadataLinks(metadata.Link); err != nil {
+		return nil, err
+	}
+	if err := checkCollections(r.collections, r.manifest); err != nil {
+		return nil, err
+	}
+
+	if r.writer.workers > 0 {
+		r.renumber()
+	}
+
+	pkg := &Package{
+		Version:          r.writer.version,
+		UniqueIdentifier: uid,
+		Lang:             metadata.Lang(),
+		Metadata:         metadata,
+		Manifest: Manifest{
+			Items: r.manifest,
+		},
+		Spine: Spine{
+			ItemRefs: r.spine,
+		},
+		Collections: r.collections,
+	}
+	if r.writer.epub2 {
+		r.compat(pkg)
+	}
+	return pkg, nil
+}
+
+// joinProperties returns the space-separated list of item properties.
+// In deterministic mode the properties are sorted and duplicates are removed.
+func (r *Rendition) joinProperties(properties []string) string {
+	if !r.writer.deterministic {
+		return strings.Join(properties, " ")
+	}
+	list := make([]string, 0, len(properties))
+	for _, property := range properties {
+		list = append(list, strings.Fields(property)...)
+	}
+	sort.Strings(list)
+	unique := list[:0]
+	for i, property := range list {
+		if i == 0 || property != list[i-1] {
+			unique = append(unique, property)
+		}
+	}
+	return strings.Join(unique, " ")
+}
+
+// contentUUID returns the publication identifier generated from the hash of
+// the publication content.
+func (r *Rendition) contentUUID() string {
+	names := make([]string, 0, len(r.digests))
+	for name := range r.digests {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	hash := sha1.New()
+	for _, name := range names {
+		io.WriteString(hash, name)
+		hash.Write([]byte{0})
+		hash.Write(r.digests[name])
+	}
+	return hashUUID(hash.Sum(nil))
+}
+
+// MappingLocation describes the location of the content in the rendition.
+type MappingLocation struct {
+	Rendition *Rendition // The rendition.
+	Href      string     // Name of the content document in the rendition.
+}
+
+// AddMapping adds the mapping unit to the rendition mapping document: the
+// locations of the same content in different renditions. The mapping document
+// is generated on Close if at least one unit is added.
+func (w *Writer) AddMapping(locations ...MappingLocation) {
+	w.mapping = append(w.mapping, locations)
+}
+
+// addMapping generates the rendition mapping document.
+func (w *Writer) addMapping() error {
+	html, body := newDocument("Rendition Mapping", "")
+	html.attrs = append(html.attrs,
+		xml.Attr{Name: xml.Name{Local: "xmlns:rendition"}, Value: nsRendition})
+	nav := newElement("nav", "epub:type", "resource-map")
+	for _, unit := range w.mapping {
+		list := newElement("ul")
+		for _, location := range unit {
+			rendition := location.Rendition
+			if rendition == nil {
+				rendition = w.Rendition
+			}
+			href := filepath.ToSlash(location.Href)
+			if !inManifest(rendition.manifest, href) {
+				return fmt.Errorf("mapping: %q is not found in the rendition %q manifest",
+					href, rendition.root)
+			}
+			selection := rendition.Selection
+			list.add(newElement("li").add(newElement("a",
+				"href", rendition.cfi(href),
+				"rendition:media", selection.Media,
+				"rendition:layout", selection.Layout,
+				"rendition:language", selection.Language,
+				"rendition:accessMode", selection.AccessMode,
+				"rendition:label", selection.Label,
+			).add(path.Base(href))))
+		}
+		nav.add(list)
+	}
+	body.add(nav)
+
+	var buf bytes.Buffer
+	if err := encodeXML(&buf, "html", html); err != nil {
+		return err
+	}
+	file, err := w.sink.Create(MappingFilename)
+	if err != nil {
+		return err
+	}
+	_, err = buf.WriteTo(file)
+	return err
+}
+
+// cfi returns the reference to the content document relative to the container
+// root. The reference to the spine document is defined as EPUB CFI.
+func (r *Rendition) cfi(href string) string {
+	var id string
+	for _, item := range r.manifest {
+		if item.Href == href {
+			id = item.ID
+			break
+		}
+	}
+	for i, itemref := range r.spine {
+		if itemref.IDRef == id {
+			// the itemrefs have no id, so the step has no id assertion
+			return fmt.Sprintf("%s#epubcfi(/6/%d!)",
+				path.Join(r.root, r.writer.packageFilename), (i+1)*2)
+		}
+	}
+	return path.Join(r.root, href)
+}
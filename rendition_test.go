@@ -0,0 +1,72 @@
+package epub_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	epub "github.com/mdigger/epub3"
+)
+
+func TestRenditions(t *testing.T) {
+	var buf bytes.Buffer
+	modified := time.Date(2021, 2, 3, 4, 5, 6, 0, time.UTC)
+	pub, err := epub.New(&buf, epub.WithClock(func() time.Time { return modified }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub.AddTitle("Test")
+	pub.Language = []epub.Element{{Value: "en"}}
+	fixed, err := pub.AddRendition("FIXED", epub.Selection{Layout: "pre-paginated"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rendition := range []*epub.Rendition{pub.Rendition, fixed} {
+		for _, name := range []string{"cover.xhtml", "chapter.xhtml"} {
+			if err := rendition.AddContent(strings.NewReader(testDocument(name, "Text.")),
+				name, epub.Primary); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	pub.AddMapping(epub.MappingLocation{Href: "chapter.xhtml"},
+		epub.MappingLocation{Rendition: fixed, Href: "chapter.xhtml"})
+	if err := pub.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var packages []*epub.Package
+	for _, name := range []string{"OEBPS/package.opf", "FIXED/package.opf"} {
+		pkg, err := epub.ReadPackage(strings.NewReader(readTestFile(t, buf.Bytes(), name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		packages = append(packages, pkg)
+	}
+	def, other := packages[0].Metadata, packages[1].Metadata
+	if len(other.Identifier) != 1 || other.Identifier[0].Value != def.Identifier[0].Value {
+		t.Errorf("rendition identifier %v, want %v", other.Identifier, def.Identifier)
+	}
+	if len(other.Title) != 1 || other.Title[0].Value != "Test" {
+		t.Errorf("rendition title %v", other.Title)
+	}
+	if other.Lang() != "en" {
+		t.Errorf("rendition language %q", other.Lang())
+	}
+
+	container := readTestFile(t, buf.Bytes(), epub.ContainerMetadataFilename)
+	if want := `<meta property="dcterms:modified">2021-02-03T04:05:06Z</meta>`; !strings.Contains(container, want) {
+		t.Errorf("container metadata does not contain %s:\n%s", want, container)
+	}
+
+	mapping := readTestFile(t, buf.Bytes(), epub.MappingFilename)
+	for _, href := range []string{
+		`href="OEBPS/package.opf#epubcfi(/6/4!)"`,
+		`href="FIXED/package.opf#epubcfi(/6/4!)"`,
+	} {
+		if !strings.Contains(mapping, href) {
+			t.Errorf("mapping document does not contain %s:\n%s", href, mapping)
+		}
+	}
+}
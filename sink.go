@@ -0,0 +1,128 @@
+package epub
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Sink is the destination of the publication files, such as zip archive or
+// directory.
+type Sink interface {
+	// Create adds a new file with the given name and returns a Writer to which
+	// the file contents should be written. The name is a slash-separated path
+	// relative to the container root. The Writer is valid until the next call
+	// to Create or Close.
+	Create(name string) (io.Writer, error)
+	// Close finishes writing of the publication files.
+	Close() error
+}
+
+// zipSink writes the publication files to the zip archive.
+type zipSink struct {
+	*zip.Writer
+	modTime time.Time // fixed modification time of files
+}
+
+// newZipSink returns the Sink writing the zip archive to w.
+func newZipSink(w io.Writer, modTime time.Time) *zipSink {
+	return &zipSink{
+		Writer:  zip.NewWriter(w),
+		modTime: modTime,
+	}
+}
+
+// Create implements Sink interface. The mimetype file is stored uncompressed
+// and without extra fields.
+func (s *zipSink) Create(name string) (io.Writer, error) {
+	return s.create(name, s.modTime)
+}
+
+// create adds a new file with the given modification time to the archive.
+func (s *zipSink) create(name string, modTime time.Time) (io.Writer, error) {
+	return s.CreateHeader(s.header(name, modTime))
+}
+
+// header returns the header of the archive file.
+func (s *zipSink) header(name string, modTime time.Time) *zip.FileHeader {
+	header := &zip.FileHeader{
+		Name:   name,
+		Method: zip.Deflate,
+	}
+	if name == "mimetype" {
+		header.Method = zip.Store
+	}
+	if !modTime.IsZero() {
+		// MS-DOS time fields are used instead of Modified, because it adds
+		// the extra field with the timestamp
+		header.ModifiedTime, header.ModifiedDate = msDosTime(modTime)
+	}
+	return header
+}
+
+// msDosTime converts time to the MS-DOS time and date format. The format
+// covers the years from 1980 to 2107, other times are clamped to the range.
+func msDosTime(t time.Time) (fTime, fDate uint16) {
+	switch {
+	case t.Year() < 1980:
+		t = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+	case t.Year() > 2107:
+		t = time.Date(2107, 12, 31, 23, 59, 58, 0, time.UTC)
+	}
+	fDate = uint16(t.Day() + int(t.Month())<<5 + (t.Year()-1980)<<9)
+	fTime = uint16(t.Second()/2 + t.Minute()<<5 + t.Hour()<<11)
+	return fTime, fDate
+}
+
+// dirSink writes the publication files to the directory.
+type dirSink struct {
+	dir     string    // root directory of the publication
+	modTime time.Time // fixed modification time of files
+	file    *os.File  // current file
+}
+
+// Create implements Sink interface.
+func (s *dirSink) Create(name string) (io.Writer, error) {
+	if err := s.closeFile(); err != nil {
+		return nil, err
+	}
+	// do not allow writing outside the directory
+	if !fs.ValidPath(name) {
+		return nil, fmt.Errorf("bad file name %q", name)
+	}
+	filename := filepath.Join(s.dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(filename), 0o755); err != nil {
+		return nil, err
+	}
+	file, err := os.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+	s.file = file
+	return file, nil
+}
+
+// Close implements Sink interface.
+func (s *dirSink) Close() error {
+	return s.closeFile()
+}
+
+// closeFile closes the current file and sets its modification time.
+func (s *dirSink) closeFile() error {
+	if s.file == nil {
+		return nil
+	}
+	file := s.file
+	s.file = nil
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if s.modTime.IsZero() {
+		return nil
+	}
+	return os.Chtimes(file.Name(), s.modTime, s.modTime)
+}
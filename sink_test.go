@@ -0,0 +1,89 @@
+package epub
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMsDosTime(t *testing.T) {
+	tests := []struct {
+		time        time.Time
+		fTime, date uint16
+	}{
+		{time.Date(2021, 3, 15, 10, 20, 30, 0, time.UTC), 10<<11 | 20<<5 | 15, 41<<9 | 3<<5 | 15},
+		{time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC), 0, 1<<5 | 1},
+		{time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC), 0, 1<<5 | 1},
+		{time.Time{}, 0, 1<<5 | 1},
+		{time.Date(2200, 1, 1, 0, 0, 0, 0, time.UTC), 23<<11 | 59<<5 | 29, 127<<9 | 12<<5 | 31},
+	}
+	for _, test := range tests {
+		fTime, fDate := msDosTime(test.time)
+		if fTime != test.fTime || fDate != test.date {
+			t.Errorf("msDosTime(%v) = %#x, %#x; want %#x, %#x",
+				test.time, fTime, fDate, test.fTime, test.date)
+		}
+	}
+}
+
+func TestNewDir(t *testing.T) {
+	dir := t.TempDir()
+	modTime := time.Date(2021, 3, 15, 10, 20, 30, 0, time.UTC)
+	pub, err := NewDir(dir, WithModTime(modTime))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub.AddTitle("Test")
+	if err := pub.AddContent(strings.NewReader(`<?xml version="1.0" encoding="UTF-8"?>
+<html xmlns="http://www.w3.org/1999/xhtml"><head><title>Text</title></head><body><p>Text</p></body></html>`),
+		"text/chapter.xhtml", Primary); err != nil {
+		t.Fatal(err)
+	}
+	pub.AddTOC("Text", "text/chapter.xhtml")
+	if err := pub.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "mimetype"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "application/epub+zip" {
+		t.Errorf("mimetype = %q", data)
+	}
+	var names []string
+	err = filepath.WalkDir(dir, func(name string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		if !info.ModTime().Equal(modTime) {
+			t.Errorf("%s modification time = %v, want %v", name, info.ModTime(), modTime)
+		}
+		rel, err := filepath.Rel(dir, name)
+		names = append(names, filepath.ToSlash(rel))
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{ContainerFilename, "OEBPS/nav.xhtml", "OEBPS/package.opf",
+		"OEBPS/text/chapter.xhtml", "mimetype"}
+	if strings.Join(names, " ") != strings.Join(want, " ") {
+		t.Errorf("files = %v, want %v", names, want)
+	}
+}
+
+func TestDirSinkBadName(t *testing.T) {
+	sink := &dirSink{dir: t.TempDir()}
+	defer sink.Close()
+	if _, err := sink.Create("../outside"); err == nil {
+		t.Error("file outside the directory is created")
+	}
+}
@@ -0,0 +1,116 @@
+package epub
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ContentError describes the problem of the content document found in strict
+// mode.
+type ContentError struct {
+	Name   string // Name of the file in the container.
+	Line   int    // Line number of the problem.
+	Column int    // Column number of the problem.
+	Msg    string // Description of the problem.
+}
+
+// Error implements error interface.
+func (e *ContentError) Error() string {
+	return fmt.Sprintf("%s:%d:%d: %s", e.Name, e.Line, e.Column, e.Msg)
+}
+
+// obsoleteElements lists the elements not allowed in XHTML content documents.
+var obsoleteElements = map[string]bool{
+	"acronym": true, "applet": true, "basefont": true, "big": true,
+	"center": true, "dir": true, "font": true, "frame": true,
+	"frameset": true, "isindex": true, "marquee": true, "noframes": true,
+	"strike": true, "tt": true,
+}
+
+// checkXHTML checks the XHTML content document with the given name.
+func checkXHTML(name string, data []byte) error {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	var (
+		stack                []xml.Name // open elements
+		head, title          bool       // head and title elements found
+		line, column         int        // position of the current token
+		rootLine, rootColumn int        // position of the root element
+	)
+	// fail returns the error at the position of the current token
+	fail := func(format string, args ...interface{}) error {
+		return &ContentError{Name: name, Line: line, Column: column,
+			Msg: fmt.Sprintf(format, args...)}
+	}
+	for {
+		line, column = dec.InputPos()
+		token, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			var syntaxErr *xml.SyntaxError
+			if errors.As(err, &syntaxErr) {
+				line, column = dec.InputPos() // position of the error
+				return fail("%s", syntaxErr.Msg)
+			}
+			return fail("%v", err)
+		}
+		switch t := token.(type) {
+		case xml.Directive:
+			if doctype, ok := strings.CutPrefix(string(t), "DOCTYPE"); ok {
+				switch strings.Join(strings.Fields(doctype), " ") {
+				case "html", `html SYSTEM "about:legacy-compat"`,
+					`html SYSTEM 'about:legacy-compat'`:
+				default:
+					return fail("document type declaration must be <!DOCTYPE html>")
+				}
+			}
+		case xml.StartElement:
+			if len(stack) == 0 {
+				if t.Name.Space != nsXHTML || t.Name.Local != "html" {
+					return fail("root element must be html in the XHTML namespace, found %q",
+						t.Name.Local)
+				}
+				rootLine, rootColumn = line, column
+			}
+			if t.Name.Space == "epub" {
+				return fail("epub namespace prefix is not declared")
+			}
+			if t.Name.Space == nsXHTML {
+				switch {
+				case obsoleteElements[t.Name.Local]:
+					return fail("element %q is not allowed", t.Name.Local)
+				case t.Name.Local == "head" && len(stack) == 1:
+					head = true
+				case t.Name.Local == "title" && len(stack) == 2 && stack[1].Local == "head":
+					title = true
+				}
+			}
+			for _, attr := range t.Attr {
+				switch {
+				case attr.Name.Space == "epub":
+					return fail("epub namespace prefix is not declared")
+				case attr.Name.Space == "xmlns" && attr.Name.Local == "epub" && attr.Value != nsOPS:
+					return fail("epub prefix must be bound to %q", nsOPS)
+				}
+			}
+			stack = append(stack, t.Name)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		}
+	}
+	line, column = rootLine, rootColumn
+	switch {
+	case line == 0:
+		return &ContentError{Name: name, Line: 1, Column: 1, Msg: "no root element"}
+	case !head:
+		return fail("head element is required")
+	case !title:
+		return fail("title element is required")
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package epub_test
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	epub "github.com/mdigger/epub3"
+)
+
+func TestStrict(t *testing.T) {
+	const head = "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n" +
+		"<html xmlns=\"http://www.w3.org/1999/xhtml\">\n"
+	tests := []struct {
+		name    string
+		content string
+		want    *epub.ContentError // nil for valid document
+	}{
+		{"valid", testDocument("Valid", "Text"), nil},
+		{"unclosed", head + "<head><title>T</title></head>\n<body><p>Text</body>\n</html>",
+			&epub.ContentError{Line: 4, Column: 21, Msg: "element <p> closed by </body>"}},
+		{"no title", head + "<head></head>\n<body/>\n</html>",
+			&epub.ContentError{Line: 2, Column: 1, Msg: "title element is required"}},
+		{"obsolete", head + "<head><title>T</title></head>\n<body><center>Text</center></body>\n</html>",
+			&epub.ContentError{Line: 4, Column: 7, Msg: `element "center" is not allowed`}},
+		{"epub prefix", head + "<head><title>T</title></head>\n<body><section epub:type=\"chapter\"/></body>\n</html>",
+			&epub.ContentError{Line: 4, Column: 7, Msg: "epub namespace prefix is not declared"}},
+		{"doctype", "<!DOCTYPE html PUBLIC \"-//W3C//DTD XHTML 1.1//EN\" \"http://www.w3.org/TR/xhtml11/DTD/xhtml11.dtd\">\n" +
+			"<html xmlns=\"http://www.w3.org/1999/xhtml\"><head><title>T</title></head><body/></html>",
+			&epub.ContentError{Line: 1, Column: 1, Msg: "document type declaration must be <!DOCTYPE html>"}},
+		{"namespace", "<html><head><title>T</title></head><body/></html>",
+			&epub.ContentError{Line: 1, Column: 1, Msg: `root element must be html in the XHTML namespace, found "html"`}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pub, err := epub.New(io.Discard, epub.Strict())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer pub.Abort()
+			err = pub.AddContent(strings.NewReader(test.content), "text/chapter.xhtml", epub.Primary)
+			if test.want == nil {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			var contentErr *epub.ContentError
+			if !errors.As(err, &contentErr) {
+				t.Fatalf("error = %v, want ContentError", err)
+			}
+			want := *test.want
+			want.Name = "OEBPS/text/chapter.xhtml"
+			if *contentErr != want {
+				t.Errorf("error = %v, want %v", contentErr, &want)
+			}
+			// the document is not added
+			if err := pub.AddContent(strings.NewReader(testDocument("Valid", "Text")),
+				"text/chapter.xhtml", epub.Primary); err != nil {
+				t.Errorf("file with the same name is not added: %v", err)
+			}
+		})
+	}
+}
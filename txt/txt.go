@@ -0,0 +1,177 @@
+// Package txt converts plain UTF-8 text to XHTML content documents of the EPUB
+// publication. The text is split into paragraphs and chapters: each chapter
+// starts with the line matching the heading pattern.
+package txt
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	epub "github.com/mdigger/epub3"
+)
+
+// DefaultHeading matches the chapter headings, such as “Chapter 1”, “PART
+// TWO”, “Prologue”, “IV” or “12.”. Roman numerals must be uppercase, so words
+// such as “ill” or “civil” are not headings.
+var DefaultHeading = regexp.MustCompile(`(?i)^(?:(?:chapter|part|book|section)\s+\S+.*|` +
+	`prologue|epilogue|introduction|preface|afterword|(?:глава|часть)\s+\S+.*|пролог|эпилог|` +
+	`(?-i:[IVXLC]+)\.?|\d+\.?)$`)
+
+// Option is the setting of the text conversion.
+type Option func(*config)
+
+// config holds the conversion settings.
+type config struct {
+	heading    *regexp.Regexp // chapter heading pattern
+	maxHeading int            // maximum length of the heading line
+	prefix     string         // prefix of the chapter file names
+}
+
+// WithHeading sets the pattern of the chapter heading lines. The DefaultHeading
+// is used by default.
+func WithHeading(re *regexp.Regexp) Option {
+	return func(cfg *config) {
+		cfg.heading = re
+	}
+}
+
+// WithFilePrefix sets the prefix of the chapter file names. The default is
+// “chapter”: chapter001.xhtml, chapter002.xhtml…
+func WithFilePrefix(prefix string) Option {
+	return func(cfg *config) {
+		cfg.prefix = prefix
+	}
+}
+
+// Import converts the text to the chapters and adds them to the publication
+// rendition, such as the default rendition of the Writer, with the table of
+// contents entries. Paragraphs are separated by blank lines or indentation; if
+// the text has no blank lines, each line is a paragraph. The text before the
+// first heading is added as the chapter with the publication title.
+func Import(r *epub.Rendition, src io.Reader, opts ...Option) error {
+	cfg := config{heading: DefaultHeading, maxHeading: 80, prefix: "chapter"}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	paragraphs, err := readParagraphs(src)
+	if err != nil {
+		return err
+	}
+
+	// split paragraphs by chapters
+	var (
+		chapters []chapter
+		current  *chapter
+	)
+	for _, paragraph := range paragraphs {
+		if len(paragraph) <= cfg.maxHeading && cfg.heading.MatchString(paragraph) {
+			chapters = append(chapters, chapter{title: paragraph, heading: true})
+			current = &chapters[len(chapters)-1]
+			continue
+		}
+		if current == nil {
+			title := "Text"
+			if len(r.Title) > 0 {
+				title = r.Title[0].Value
+			}
+			chapters = append(chapters, chapter{title: title})
+			current = &chapters[len(chapters)-1]
+		}
+		current.paragraphs = append(current.paragraphs, paragraph)
+	}
+
+	// write chapters
+	for i, chapter := range chapters {
+		name := fmt.Sprintf("%s%03d.xhtml", cfg.prefix, i+1)
+		if err := r.AddContent(chapter.document(r.Lang()), name, epub.Primary); err != nil {
+			return err
+		}
+		r.AddTOC(chapter.title, name)
+	}
+	return nil
+}
+
+// readParagraphs returns the paragraphs of the text.
+func readParagraphs(src io.Reader) ([]string, error) {
+	var lines []string
+	scanner := bufio.NewScanner(src)
+	scanner.Buffer(nil, 1<<20)
+	var blank bool // text has blank lines
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if len(lines) == 0 {
+			line = strings.TrimPrefix(line, "\ufeff")
+		}
+		if line == "" {
+			blank = true
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	var (
+		paragraphs []string
+		current    []string
+	)
+	flush := func() {
+		if len(current) > 0 {
+			paragraphs = append(paragraphs, strings.Join(current, " "))
+			current = current[:0]
+		}
+	}
+	for _, line := range lines {
+		switch {
+		case line == "":
+			flush()
+			continue
+		case !blank, line[0] == ' ' || line[0] == '\t':
+			flush() // each line or indented line starts the paragraph
+		}
+		current = append(current, strings.TrimSpace(line))
+	}
+	flush()
+	return paragraphs, nil
+}
+
+// chapter describes the chapter of the text.
+type chapter struct {
+	title      string
+	heading    bool // the title is the heading of the text
+	paragraphs []string
+}
+
+// document returns the XHTML content document of the chapter.
+func (c chapter) document(lang string) io.Reader {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	buf.WriteString("<!DOCTYPE html>\n<html xmlns=\"http://www.w3.org/1999/xhtml\"")
+	if lang != "" {
+		buf.WriteString(` xml:lang="`)
+		xml.EscapeText(&buf, []byte(lang))
+		buf.WriteString(`" lang="`)
+		xml.EscapeText(&buf, []byte(lang))
+		buf.WriteString(`"`)
+	}
+	buf.WriteString(">\n<head>\n<title>")
+	xml.EscapeText(&buf, []byte(c.title))
+	buf.WriteString("</title>\n</head>\n<body>\n")
+	if c.heading {
+		buf.WriteString("<h1>")
+		xml.EscapeText(&buf, []byte(c.title))
+		buf.WriteString("</h1>\n")
+	}
+	for _, paragraph := range c.paragraphs {
+		buf.WriteString("<p>")
+		xml.EscapeText(&buf, []byte(paragraph))
+		buf.WriteString("</p>\n")
+	}
+	buf.WriteString("</body>\n</html>\n")
+	return &buf
+}
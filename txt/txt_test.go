@@ -0,0 +1,113 @@
+package txt_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"regexp"
+	"strings"
+	"testing"
+
+	epub "github.com/mdigger/epub3"
+	"github.com/mdigger/epub3/txt"
+)
+
+func TestDefaultHeading(t *testing.T) {
+	for line, want := range map[string]bool{
+		"Chapter 1":   true,
+		"PART TWO":    true,
+		"Prologue":    true,
+		"Глава 5":     true,
+		"IV":          true,
+		"XII.":        true,
+		"12.":         true,
+		"ill":         false,
+		"Civil":       false,
+		"civil":       false,
+		"iv":          false,
+		"Mix":         false,
+		"Chapterhood": false,
+		"Text line.":  false,
+	} {
+		if got := txt.DefaultHeading.MatchString(line); got != want {
+			t.Errorf("DefaultHeading.MatchString(%q) = %v, want %v", line, got, want)
+		}
+	}
+}
+
+// readFile returns the content of the file from the publication archive.
+func readFile(t *testing.T, data []byte, name string) string {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := zr.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	content, err := io.ReadAll(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+func TestImport(t *testing.T) {
+	const text = "\ufeffForeword text\nwith two lines.\n\n" +
+		"Chapter 1\n\nFirst paragraph\ncontinued.\n  Indented <paragraph> & more.\n\n" +
+		"Scene: two\n\nLast paragraph.\n"
+	var buf bytes.Buffer
+	pub, err := epub.New(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub.AddTitle("Book")
+	if err := pub.SetLang("en"); err != nil {
+		t.Fatal(err)
+	}
+	if err := txt.Import(pub.Rendition, strings.NewReader(text), txt.WithFilePrefix("part"),
+		txt.WithHeading(regexp.MustCompile(`^(Chapter \d+|Scene: .+)$`))); err != nil {
+		t.Fatal(err)
+	}
+	if err := pub.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	for name, wants := range map[string][]string{
+		"OEBPS/part001.xhtml": {`<html xmlns="http://www.w3.org/1999/xhtml" xml:lang="en" lang="en">`,
+			"<title>Book</title>", "<body>\n<p>Foreword text with two lines.</p>\n</body>"},
+		"OEBPS/part002.xhtml": {"<title>Chapter 1</title>", "<h1>Chapter 1</h1>",
+			"<p>First paragraph continued.</p>\n<p>Indented &lt;paragraph&gt; &amp; more.</p>"},
+		"OEBPS/part003.xhtml": {"<h1>Scene: two</h1>\n<p>Last paragraph.</p>"},
+		"OEBPS/nav.xhtml": {`<a href="part001.xhtml">Book</a>`,
+			`<a href="part002.xhtml">Chapter 1</a>`, `<a href="part003.xhtml">Scene: two</a>`},
+	} {
+		content := readFile(t, data, name)
+		for _, want := range wants {
+			if !strings.Contains(content, want) {
+				t.Errorf("%s does not contain %q:\n%s", name, want, content)
+			}
+		}
+	}
+}
+
+func TestImportLines(t *testing.T) {
+	// the text without blank lines: each line is a paragraph
+	var buf bytes.Buffer
+	pub, err := epub.New(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := txt.Import(pub.Rendition, strings.NewReader("CHAPTER ONE\r\nFirst.\r\nSecond.\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := pub.Close(); err != nil {
+		t.Fatal(err)
+	}
+	content := readFile(t, buf.Bytes(), "OEBPS/chapter001.xhtml")
+	if want := "<h1>CHAPTER ONE</h1>\n<p>First.</p>\n<p>Second.</p>"; !strings.Contains(content, want) {
+		t.Errorf("content does not contain %q:\n%s", want, content)
+	}
+}
@@ -0,0 +1,379 @@
+package epub
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/mdigger/epub3/internal/ocf"
+)
+
+// guideLandmarks maps the EPUB 2 guide reference types to the structural
+// semantics of the navigation document landmarks.
+var guideLandmarks = map[string]string{
+	"acknowledgements": "acknowledgments",
+	"bibliography":     "bibliography",
+	"colophon":         "colophon",
+	"copyright-page":   "copyright-page",
+	"cover":            "cover",
+	"dedication":       "dedication",
+	"epigraph":         "epigraph",
+	"foreword":         "foreword",
+	"glossary":         "glossary",
+	"index":            "index",
+	"loi":              "loi",
+	"lot":              "lot",
+	"notes":            "endnotes",
+	"preface":          "preface",
+	"text":             "bodymatter",
+	"title-page":       "titlepage",
+	"toc":              "toc",
+}
+
+// dateEvents maps the EPUB 2 date events to the meta properties. The first
+// publication date or the date without event is the dc:date element.
+var dateEvents = map[string]string{
+	"":                     "",
+	"publication":          "",
+	"ops-publication":      "",
+	"issued":               DateIssued,
+	"original-publication": DateIssued,
+	"creation":             DateCreated,
+	"created":              DateCreated,
+	"copyright":            DateCopyrighted,
+	"modification":         "dcterms:modified",
+	"modified":             "dcterms:modified",
+}
+
+// Upgrade writes the EPUB 2 publication from the file system, such as the
+// zip.Reader of the publication or os.DirFS(dir), to w as EPUB 3 publication.
+// The packages of version 2 are upgraded with UpgradePackage, the navigation
+// documents are generated from the NCX and the guide. Other files are copied
+// unchanged; the NCX and the guide are kept for EPUB 2 reading systems.
+func Upgrade(w io.Writer, fsys fs.FS, opts ...Option) error {
+	cfg := newConfig(opts)
+	data, err := fs.ReadFile(fsys, ContainerFilename)
+	if err != nil {
+		return err
+	}
+	container, err := ReadContainer(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("%s: %w", ContainerFilename, err)
+	}
+	files := make(map[string][]byte)
+	for _, rootfile := range container.Rootfiles {
+		data, err := fs.ReadFile(fsys, rootfile.FullPath)
+		if err != nil {
+			return err
+		}
+		pkg, err := ReadPackage(bytes.NewReader(data))
+		if err != nil {
+			return fmt.Errorf("%s: %w", rootfile.FullPath, err)
+		}
+		if strings.HasPrefix(pkg.Version, "3.") {
+			continue // already upgraded
+		}
+		root := path.Dir(rootfile.FullPath)
+
+		// read NCX
+		var ncx *NCX
+		for _, item := range pkg.Manifest.Items {
+			if item.ID != pkg.Spine.Toc && (pkg.Spine.Toc != "" ||
+				item.MediaType != "application/x-dtbncx+xml") {
+				continue
+			}
+			name, ok := ocf.Resolve(root, item.Href)
+			if !ok {
+				break
+			}
+			data, err := fs.ReadFile(fsys, name)
+			if err != nil {
+				return err
+			}
+			if ncx, err = ReadNCX(bytes.NewReader(data)); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			// references of the NCX are relative to the NCX file
+			ncx.rebase(path.Dir(item.Href))
+			break
+		}
+
+		nav, err := UpgradePackage(pkg, ncx, cfg.clock())
+		if err != nil {
+			return fmt.Errorf("%s: %w", rootfile.FullPath, err)
+		}
+		if nav != nil {
+			files[path.Join(root, NavFilename)] = nav
+		}
+		var buf bytes.Buffer
+		if err := encodeXML(&buf, "", pkg); err != nil {
+			return err
+		}
+		files[rootfile.FullPath] = buf.Bytes()
+	}
+	return pack(w, fsys, cfg, files)
+}
+
+// rebase converts the references of the NCX entries relative to the folder
+// to the references relative to the package folder.
+func (n *NCX) rebase(dir string) {
+	if dir == "." {
+		return
+	}
+	var rebase func(points []NCXPoint)
+	rebase = func(points []NCXPoint) {
+		for i := range points {
+			if name, ok := ocf.Resolve(dir, points[i].Content.Src); ok {
+				if _, fragment, found := strings.Cut(points[i].Content.Src, "#"); found {
+					name += "#" + fragment
+				}
+				points[i].Content.Src = name
+			}
+			rebase(points[i].Children)
+		}
+	}
+	rebase(n.NavMap)
+}
+
+// UpgradePackage converts the EPUB 2 package to EPUB 3: the opf:role,
+// opf:file-as and opf:scheme attributes are converted to the refinements, the
+// dates with the opf:event attribute to the dc:date element and the
+// dcterms:created, dcterms:issued and other meta elements, the cover image
+// defined by the cover meta gets the cover-image property, and the
+// modification time is set unless the modification date of the package is
+// later. If the package has no navigation document,
+// it is added to the manifest and its content generated from the NCX (or from
+// the spine if the NCX is nil) and the guide is returned; the document is
+// placed in the package folder with the NavFilename name.
+func UpgradePackage(pkg *Package, ncx *NCX, modified time.Time) ([]byte, error) {
+	pkg.Version = "3.0"
+	m := &pkg.Metadata
+	if m.DC == "" {
+		m.DC = nsDC
+	}
+
+	// convert EPUB 2 attributes to refinements
+	ids := m.ids()
+	for _, item := range pkg.Manifest.Items {
+		ids[item.ID] = true
+	}
+	newID := func(prefix string) string {
+		for n := 1; ; n++ {
+			id := fmt.Sprintf("%s%02d", prefix, n)
+			if !ids[id] {
+				ids[id] = true
+				return id
+			}
+		}
+	}
+	m.refineEPUB2Attrs(ids)
+	dates := m.dates
+	if len(dates) == 0 && m.Date != nil {
+		dates = []Element{*m.Date}
+	}
+	m.Date, m.dates = nil, nil
+	for _, date := range dates {
+		date := date
+		property, ok := dateEvents[strings.ToLower(date.Event)]
+		if !ok {
+			property = "dcterms:date" // date of other event
+		}
+		date.Event = ""
+		switch {
+		case property == "" && m.Date == nil:
+			m.Date = &date
+			continue
+		case property == "":
+			property = DateIssued // other publication dates
+		case property == "dcterms:modified":
+			if t, err := parseDate(date.Value); err == nil && t.After(modified) {
+				modified = t
+			}
+			continue
+		}
+		m.Meta = append(m.Meta, Meta{ID: date.ID, Property: property, Value: date.Value})
+	}
+	if !m.usesOPF() {
+		m.OPF = "" // EPUB 2 attributes are converted
+	}
+
+	// cover image
+	for _, meta := range m.Meta {
+		if meta.Name != "cover" {
+			continue
+		}
+		for i, item := range pkg.Manifest.Items {
+			if item.ID == meta.Content && strings.HasPrefix(item.MediaType, "image/") &&
+				!hasProperty(item.Properties, "cover-image") {
+				pkg.Manifest.Items[i].Properties = strings.TrimSpace(item.Properties + " cover-image")
+			}
+		}
+	}
+	m.SetModified(modified)
+
+	// navigation document
+	for _, item := range pkg.Manifest.Items {
+		switch {
+		case hasProperty(item.Properties, "nav"):
+			return nil, nil // already defined
+		case item.Href == NavFilename:
+			return nil, fmt.Errorf("manifest item %q is not a navigation document", item.Href)
+		}
+	}
+	var toc []*NavPoint
+	if ncx != nil {
+		var convert func(points []NCXPoint) []*NavPoint
+		convert = func(points []NCXPoint) []*NavPoint {
+			list := make([]*NavPoint, len(points))
+			for i, point := range points {
+				list[i] = &NavPoint{
+					Title:    strings.TrimSpace(point.Label),
+					Href:     point.Content.Src,
+					Children: convert(point.Children),
+				}
+			}
+			return list
+		}
+		toc = convert(ncx.NavMap)
+	}
+	if len(toc) == 0 {
+		for _, itemref := range pkg.Spine.ItemRefs {
+			for _, item := range pkg.Manifest.Items {
+				if item.ID == itemref.IDRef && itemref.Linear != "no" {
+					title := strings.TrimSuffix(path.Base(item.Href), path.Ext(item.Href))
+					toc = append(toc, &NavPoint{Title: title, Href: item.Href})
+				}
+			}
+		}
+	}
+	var landmarks []Landmark
+	if pkg.Guide != nil {
+		for _, reference := range pkg.Guide.References {
+			if typ := guideLandmarks[reference.Type]; typ != "" {
+				landmarks = append(landmarks,
+					Landmark{Type: typ, Title: reference.Title, Href: reference.Href})
+			}
+		}
+	}
+	var title string
+	if len(m.Title) > 0 {
+		title = m.Title[0].Value
+	}
+	nav, err := navDocument(title, m.Lang(), toc, landmarks)
+	if err != nil {
+		return nil, err
+	}
+	pkg.Manifest.Items = append(pkg.Manifest.Items, Item{
+		ID:         newID("nav"),
+		Href:       NavFilename,
+		MediaType:  "application/xhtml+xml",
+		Properties: "nav",
+	})
+	return nav, nil
+}
+
+// refineEPUB2Attrs converts the opf:role, opf:file-as and opf:scheme
+// attributes of the metadata elements to the refinements. The elements without
+// identifier get the identifiers not used in ids, which are added to ids.
+func (m *Metadata) refineEPUB2Attrs(ids map[string]bool) {
+	newID := func(prefix string) string {
+		for n := 1; ; n++ {
+			id := fmt.Sprintf("%s%02d", prefix, n)
+			if !ids[id] {
+				ids[id] = true
+				return id
+			}
+		}
+	}
+	refine := func(id, property, scheme, value string) {
+		for _, meta := range m.Meta {
+			if meta.Refines == "#"+id && meta.Property == property {
+				return // already defined
+			}
+		}
+		m.Meta = append(m.Meta, Meta{Refines: "#" + id, Property: property, Scheme: scheme,
+			Value: value})
+	}
+	for _, list := range []struct {
+		prefix string
+		items  []ElementLang
+	}{
+		{"creator", m.Creator},
+		{"contributor", m.Contributor},
+	} {
+		for i := range list.items {
+			item := &list.items[i]
+			if item.Role == "" && item.FileAs == "" {
+				continue
+			}
+			if item.ID == "" {
+				item.ID = newID(list.prefix)
+			}
+			if item.Role != "" {
+				refine(item.ID, "role", "marc:relators", item.Role)
+			}
+			if item.FileAs != "" {
+				refine(item.ID, "file-as", "", item.FileAs)
+			}
+			item.Role, item.FileAs = "", ""
+		}
+	}
+	for i := range m.Identifier {
+		item := &m.Identifier[i]
+		switch scheme := strings.ToLower(item.Scheme); {
+		case scheme == "":
+		case (scheme == "isbn" || scheme == "uuid") && !strings.HasPrefix(item.Value, "urn:"):
+			item.Value = "urn:" + scheme + ":" + item.Value
+		case scheme != "isbn" && scheme != "uuid":
+			if item.ID == "" {
+				item.ID = newID("identifier")
+			}
+			refine(item.ID, "identifier-type", "", item.Scheme)
+		}
+		item.Scheme = ""
+	}
+}
+
+// usesOPF returns true if the preserved unknown attributes of the metadata
+// elements use the opf prefix.
+func (m *Metadata) usesOPF() bool {
+	var attrs [][]xml.Attr
+	for _, list := range [][]Element{m.Identifier, m.Language, m.Type, m.Format, m.Source} {
+		for _, item := range list {
+			attrs = append(attrs, item.Attrs)
+		}
+	}
+	if m.Date != nil {
+		attrs = append(attrs, m.Date.Attrs)
+	}
+	for _, list := range [][]ElementLang{
+		m.Title, m.Creator, m.Contributor, m.Subject, m.Description,
+		m.Publisher, m.Relation, m.Coverage, m.Rights,
+	} {
+		for _, item := range list {
+			attrs = append(attrs, item.Attrs)
+		}
+	}
+	for _, item := range m.Meta {
+		attrs = append(attrs, item.Attrs)
+	}
+	for _, item := range m.Link {
+		attrs = append(attrs, item.Attrs)
+	}
+	for _, item := range m.Extensions {
+		attrs = append(attrs, item.Attrs)
+	}
+	for _, list := range attrs {
+		for _, attr := range list {
+			if strings.HasPrefix(attr.Name.Local, "opf:") {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,171 @@
+package epub_test
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	epub "github.com/mdigger/epub3"
+	"github.com/mdigger/epub3/validate"
+)
+
+// testEPUB2 returns the files of the EPUB 2 publication.
+func testEPUB2() fstest.MapFS {
+	files := map[string]string{
+		"mimetype": "application/epub+zip",
+		"META-INF/container.xml": `<?xml version="1.0" encoding="UTF-8"?>
+<container xmlns="urn:oasis:names:tc:opendocument:xmlns:container" version="1.0">
+<rootfiles><rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/></rootfiles>
+</container>`,
+		"OEBPS/content.opf": `<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="2.0" unique-identifier="bookid">
+<metadata xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:opf="http://www.idpf.org/2007/opf">
+<dc:identifier id="bookid" opf:scheme="ISBN">9780000000000</dc:identifier>
+<dc:title>Old Book</dc:title>
+<dc:language>en</dc:language>
+<dc:creator opf:role="aut" opf:file-as="Smith, John">John Smith</dc:creator>
+<dc:date opf:event="publication">2001</dc:date>
+<meta name="cover" content="cover"/>
+</metadata>
+<manifest>
+<item id="ncx" href="toc.ncx" media-type="application/x-dtbncx+xml"/>
+<item id="cover" href="images/cover.jpg" media-type="image/jpeg"/>
+<item id="text" href="text/chapter.xhtml" media-type="application/xhtml+xml"/>
+</manifest>
+<spine toc="ncx"><itemref idref="text"/></spine>
+<guide><reference type="text" title="Start" href="text/chapter.xhtml"/></guide>
+</package>`,
+		"OEBPS/toc.ncx": `<?xml version="1.0" encoding="UTF-8"?>
+<ncx xmlns="http://www.daisy.org/z3986/2005/ncx/" version="2005-1">
+<head><meta name="dtb:uid" content="9780000000000"/></head>
+<docTitle><text>Old Book</text></docTitle>
+<navMap><navPoint id="p1" playOrder="1"><navLabel><text>Chapter</text></navLabel>
+<content src="text/chapter.xhtml#start"/></navPoint></navMap>
+</ncx>`,
+		"OEBPS/images/cover.jpg": "\xff\xd8\xff\xe0",
+		"OEBPS/text/chapter.xhtml": `<?xml version="1.0" encoding="UTF-8"?>
+<html xmlns="http://www.w3.org/1999/xhtml" xml:lang="en">
+<head><title>Chapter</title></head>
+<body><h1 id="start">Chapter</h1><img src="../images/cover.jpg" alt="Cover"/></body>
+</html>`,
+	}
+	fsys := make(fstest.MapFS, len(files))
+	for name, data := range files {
+		fsys[name] = &fstest.MapFile{Data: []byte(data)}
+	}
+	return fsys
+}
+
+func TestUpgrade(t *testing.T) {
+	var buf bytes.Buffer
+	modified := time.Date(2021, 2, 3, 4, 5, 6, 0, time.UTC)
+	if err := epub.Upgrade(&buf, testEPUB2(), epub.WithClock(func() time.Time { return modified })); err != nil {
+		t.Fatal(err)
+	}
+	messages, err := validate.Zip(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, msg := range messages {
+		if msg.Severity == validate.Error {
+			t.Error(msg)
+		}
+	}
+
+	pkg, err := epub.ReadPackage(strings.NewReader(readTestFile(t, buf.Bytes(), "OEBPS/content.opf")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pkg.Version != "3.0" {
+		t.Errorf("version = %q, want 3.0", pkg.Version)
+	}
+	if id := pkg.Metadata.Identifier[0]; id.Value != "urn:isbn:9780000000000" || id.Scheme != "" {
+		t.Errorf("identifier = %q (scheme %q)", id.Value, id.Scheme)
+	}
+	creator := pkg.Metadata.Creator[0]
+	if creator.Role != "" || creator.FileAs != "" {
+		t.Errorf("creator keeps opf attributes: %+v", creator)
+	}
+	refinements := make(map[string]string)
+	for _, meta := range pkg.Metadata.Meta {
+		if meta.Refines == "#"+creator.ID {
+			refinements[meta.Property] = meta.Value
+		}
+	}
+	if refinements["role"] != "aut" || refinements["file-as"] != "Smith, John" {
+		t.Errorf("creator refinements = %v", refinements)
+	}
+	if got, _ := pkg.Metadata.Modified(); !got.Equal(modified) {
+		t.Errorf("modified = %v, want %v", got, modified)
+	}
+	var nav, cover bool
+	for _, item := range pkg.Manifest.Items {
+		nav = nav || item.Href == epub.NavFilename && item.Properties == "nav"
+		cover = cover || item.ID == "cover" && item.Properties == "cover-image"
+	}
+	if !nav || !cover {
+		t.Errorf("manifest = %+v", pkg.Manifest.Items)
+	}
+	doc := readTestFile(t, buf.Bytes(), "OEBPS/"+epub.NavFilename)
+	for _, want := range []string{`href="text/chapter.xhtml#start"`, `epub:type="bodymatter"`} {
+		if !strings.Contains(doc, want) {
+			t.Errorf("navigation document does not contain %s:\n%s", want, doc)
+		}
+	}
+}
+
+func TestUpgradePackageDates(t *testing.T) {
+	const opf = `<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="2.0" unique-identifier="bookid">
+<metadata xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:opf="http://www.idpf.org/2007/opf">
+<dc:identifier id="bookid">urn:uuid:1</dc:identifier>
+<dc:title>Old Book</dc:title>
+<dc:language>en</dc:language>
+<dc:date opf:event="creation">1999-05</dc:date>
+<dc:date opf:event="publication">2001-02-03</dc:date>
+<dc:date opf:event="original-publication">1890</dc:date>
+<dc:date opf:event="conversion">2010-01-01</dc:date>
+<dc:date opf:event="modification">2030-04-05</dc:date>
+</metadata>
+<manifest><item id="text" href="text.xhtml" media-type="application/xhtml+xml"/></manifest>
+<spine><itemref idref="text"/></spine>
+</package>`
+	pkg, err := epub.ReadPackage(strings.NewReader(opf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	modified := time.Date(2021, 2, 3, 4, 5, 6, 0, time.UTC)
+	if _, err := epub.UpgradePackage(pkg, nil, modified); err != nil {
+		t.Fatal(err)
+	}
+	m := &pkg.Metadata
+	if m.Date == nil || m.Date.Value != "2001-02-03" || m.Date.Event != "" {
+		t.Errorf("date = %+v, want 2001-02-03", m.Date)
+	}
+	meta := make(map[string]string)
+	for _, item := range m.Meta {
+		meta[item.Property] = item.Value
+	}
+	for property, want := range map[string]string{
+		epub.DateCreated:   "1999-05",
+		epub.DateIssued:    "1890",
+		"dcterms:date":     "2010-01-01",
+		"dcterms:modified": "2030-04-05T00:00:00Z", // later than the upgrade
+	} {
+		if meta[property] != want {
+			t.Errorf("meta %s = %q, want %q", property, meta[property], want)
+		}
+	}
+
+	// the written package has only one date element
+	out, err := xml.Marshal(pkg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(out), "<dc:date"); n != 1 || strings.Contains(string(out), "opf:event") {
+		t.Errorf("package dates:\n%s", out)
+	}
+}
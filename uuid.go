@@ -13,8 +13,21 @@ func NewUUID() string {
 	if _, err := io.ReadFull(rand.Reader, uuid[:]); err != nil {
 		panic(err)
 	}
-	uuid[6] = (uuid[6] & 0x0f) | 0x40 // set version byte
-	uuid[8] = (uuid[8] & 0x3f) | 0x80 // set high order byte 0b10{8,9,a,b}
+	return formatUUID(uuid, 4)
+}
+
+// hashUUID returns the name-based UUID (version 5) built from the SHA-1 hash sum.
+func hashUUID(sum []byte) string {
+	var uuid [16]byte
+	copy(uuid[:], sum)
+	return formatUUID(uuid, 5)
+}
+
+// formatUUID sets the version and variant bits and returns the canonical
+// namespaced string representation of a UUID.
+func formatUUID(uuid [16]byte, version byte) string {
+	uuid[6] = (uuid[6] & 0x0f) | version<<4 // set version byte
+	uuid[8] = (uuid[8] & 0x3f) | 0x80       // set high order byte 0b10{8,9,a,b}
 	return fmt.Sprintf("urn:uuid:%x-%x-%x-%x-%x",
 		uuid[0:4], uuid[4:6], uuid[6:8], uuid[8:10], uuid[10:])
 }
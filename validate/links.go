@@ -0,0 +1,297 @@
+package validate
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	epub "github.com/mdigger/epub3"
+	"github.com/mdigger/epub3/internal/ocf"
+)
+
+// nsXLink is the namespace of the XLink attributes used in SVG documents.
+const nsXLink = "http://www.w3.org/1999/xlink"
+
+// reference describes the reference to the resource found in the document.
+type reference struct {
+	href     string   // referenced IRI
+	location Location // place of the reference
+}
+
+// document describes the references and identifiers of the parsed publication
+// resource.
+type document struct {
+	refs []reference     // references to other resources
+	ids  map[string]bool // identifiers of elements; nil for style sheets and malformed documents
+	navs []string        // epub:type values of nav elements
+}
+
+// document returns the parsed publication resource with the given name. The
+// documents are parsed once; the parse errors are reported on the first call.
+// Returns nil if the file does not exist or has unsupported media type.
+func (v *validator) document(name, mediaType string) (*document, error) {
+	if doc, ok := v.docs[name]; ok {
+		return doc, nil
+	}
+	var doc *document
+	switch mediaType {
+	case "application/xhtml+xml", "image/svg+xml", "text/css":
+		data, ok, err := v.readFile(name)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		if mediaType == "text/css" {
+			doc = &document{refs: cssRefs(Location{Path: name, Line: 1, Column: 1}, string(data))}
+			break
+		}
+		if doc, err = parseXML(name, data); err != nil {
+			v.parseError(name, err)
+		}
+	}
+	if v.docs == nil {
+		v.docs = make(map[string]*document)
+	}
+	v.docs[name] = doc
+	return doc, nil
+}
+
+// parseXML returns the references and identifiers of the XHTML or SVG
+// document. On error the references found before the error are returned
+// without identifiers.
+func parseXML(name string, data []byte) (*document, error) {
+	doc := &document{ids: make(map[string]bool)}
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	dec.Entity = xml.HTMLEntity
+	var style bool // inside the style element
+	for {
+		line, column := dec.InputPos()
+		location := Location{Path: name, Line: line, Column: column}
+		token, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			return doc, nil
+		}
+		if err != nil {
+			doc.ids = nil
+			return doc, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			style = t.Name.Local == "style"
+			for _, attr := range t.Attr {
+				switch {
+				case attr.Name.Space == "" && attr.Name.Local == "id":
+					doc.ids[attr.Value] = true
+				case attr.Name.Space == "" && attr.Name.Local == "style":
+					doc.refs = append(doc.refs, cssRefs(location, attr.Value)...)
+				case attr.Name.Space == "" && attr.Name.Local == "srcset":
+					for _, candidate := range strings.Split(attr.Value, ",") {
+						if fields := strings.Fields(candidate); len(fields) > 0 {
+							doc.refs = append(doc.refs, reference{fields[0], location})
+						}
+					}
+				case attr.Name.Space == "" && isRefAttr(t.Name.Local, attr.Name.Local),
+					attr.Name.Space == nsXLink && attr.Name.Local == "href":
+					doc.refs = append(doc.refs, reference{strings.TrimSpace(attr.Value), location})
+				case attr.Name.Space == nsOPS && attr.Name.Local == "type" && t.Name.Local == "nav":
+					doc.navs = append(doc.navs, attr.Value)
+				}
+			}
+		case xml.EndElement:
+			style = false
+		case xml.CharData:
+			if style {
+				doc.refs = append(doc.refs, cssRefs(location, string(t))...)
+			}
+		}
+	}
+}
+
+// isRefAttr returns true if the attribute of the element contains the
+// reference to the resource.
+func isRefAttr(element, attr string) bool {
+	switch attr {
+	case "href", "src", "poster", "altimg":
+		return true
+	case "data":
+		return element == "object"
+	default:
+		return false
+	}
+}
+
+// cssURL matches the references in the style sheet: url() and @import.
+var cssURL = regexp.MustCompile(`(?:url\(\s*(?:"([^"]*)"|'([^']*)'|([^)"'\s]*))\s*\))|` +
+	`(?:@import\s+(?:"([^"]*)"|'([^']*)'))|(?s:/\*.*?\*/)`)
+
+// cssRefs returns the references found in the style sheet that starts at the
+// location.
+func cssRefs(location Location, css string) []reference {
+	var refs []reference
+	for _, match := range cssURL.FindAllStringSubmatchIndex(css, -1) {
+		var href string
+		for i := 2; i < len(match); i += 2 {
+			if match[i] >= 0 {
+				href = css[match[i]:match[i+1]]
+				break
+			}
+		}
+		if href == "" {
+			continue // comment or empty reference
+		}
+		// calculate the position of the reference
+		loc := location
+		prefix := css[:match[0]]
+		if lines := strings.Count(prefix, "\n"); lines > 0 {
+			loc.Line += lines
+			loc.Column = len(prefix) - strings.LastIndex(prefix, "\n")
+		} else {
+			loc.Column += len(prefix)
+		}
+		refs = append(refs, reference{href, loc})
+	}
+	return refs
+}
+
+// checkLinks checks the references of the XHTML, SVG and CSS resources:
+// the referenced files must be listed in the manifest, the fragment
+// identifiers must exist in the referenced documents. Manifest items that are
+// never referenced are reported as unused.
+func (c *pkgChecker) checkLinks() error {
+	if c.fsys == nil {
+		return nil
+	}
+	items := make(map[string]epub.Item, len(c.pkg.Manifest.Items)) // by file name
+	names := make([]string, 0, len(c.pkg.Manifest.Items))
+	for _, item := range c.pkg.Manifest.Items {
+		name, ok := ocf.Resolve(c.root, item.Href)
+		if !ok {
+			continue
+		}
+		if _, ok := items[name]; !ok {
+			names = append(names, name)
+		}
+		items[name] = item
+		if _, err := c.document(name, item.MediaType); err != nil {
+			return err
+		}
+	}
+	used := c.packageRefs()
+
+	// check references of documents
+	sort.Strings(names)
+	for _, name := range names {
+		doc := c.docs[name]
+		if doc == nil {
+			continue
+		}
+		for _, ref := range doc.refs {
+			target, fragment, ok := resolveRef(name, ref.href)
+			if !ok {
+				continue // remote resource
+			}
+			if target != name {
+				used[target] = true
+			}
+			if _, ok := items[target]; !ok {
+				if _, exists, err := c.readFile(target); err != nil {
+					return err
+				} else if exists {
+					c.add(Error, CodeLink, ref.location, "referenced file %q is not listed in the manifest",
+						target)
+				} else {
+					c.add(Error, CodeLink, ref.location, "referenced file %q is missing", target)
+				}
+				continue
+			}
+			if fragment == "" || strings.Contains(fragment, "(") {
+				continue // no fragment or fragment scheme, such as epubcfi() or svgView()
+			}
+			if doc := c.docs[target]; doc != nil && doc.ids != nil && !doc.ids[fragment] {
+				c.add(Error, CodeFragment, ref.location, "fragment identifier %q is not defined in %q",
+					fragment, target)
+			}
+		}
+	}
+
+	// report unused resources
+	for _, item := range c.pkg.Manifest.Items {
+		name, ok := ocf.Resolve(c.root, item.Href)
+		if ok && !used[name] && c.exists(name) { // missing files are reported by checkManifest
+			c.add(Warning, CodeUnused, c.location, "manifest item %q is never referenced", item.Href)
+		}
+	}
+	return nil
+}
+
+// exists returns true if the publication file exists.
+func (c *pkgChecker) exists(name string) bool {
+	_, ok, _ := c.readFile(name)
+	return ok
+}
+
+// packageRefs returns the names of files referenced from the package
+// document: spine items, navigation document, cover image, fallbacks, media
+// overlays, metadata and collection links.
+func (c *pkgChecker) packageRefs() map[string]bool {
+	used := make(map[string]bool)
+	use := func(href string) {
+		if name, ok := ocf.Resolve(c.root, href); ok {
+			used[name] = true
+		}
+	}
+	useID := func(id string) {
+		if item, ok := c.items[id]; ok {
+			use(item.Href)
+		}
+	}
+	for _, item := range c.pkg.Manifest.Items {
+		if hasProperty(item.Properties, "nav") || hasProperty(item.Properties, "cover-image") {
+			use(item.Href)
+		}
+		useID(item.Fallback)
+		useID(item.MediaOverlay)
+	}
+	for _, itemref := range c.pkg.Spine.ItemRefs {
+		useID(itemref.IDRef)
+	}
+	useID(c.pkg.Spine.Toc)
+	for _, link := range c.pkg.Metadata.Link {
+		use(link.Href)
+	}
+	var useCollections func(collections []*epub.Collection)
+	useCollections = func(collections []*epub.Collection) {
+		for _, collection := range collections {
+			for _, link := range collection.Links {
+				use(link.Href)
+			}
+			useCollections(collection.Collections)
+		}
+	}
+	useCollections(c.pkg.Collections)
+	return used
+}
+
+// resolveRef returns the name of the file and the fragment identifier
+// referenced from the document. Returns false if the reference is not local.
+func resolveRef(name, href string) (string, string, bool) {
+	ref, err := url.Parse(href)
+	if err != nil || ref.Scheme != "" || ref.Host != "" || href == "" {
+		return "", "", false
+	}
+	if ref.Path == "" {
+		return name, ref.Fragment, true // reference to the same document
+	}
+	if strings.HasPrefix(ref.Path, "/") {
+		return strings.TrimPrefix(path.Clean(ref.Path), "/"), ref.Fragment, true
+	}
+	return path.Join(path.Dir(name), ref.Path), ref.Fragment, true
+}
@@ -0,0 +1,37 @@
+package validate_test
+
+import (
+	"testing"
+
+	"github.com/mdigger/epub3/validate"
+)
+
+func TestLinks(t *testing.T) {
+	testValidate(t, []validateTest{
+		{
+			name:    "dangling href",
+			replace: []string{`<p id="start">Text</p>`, `<p id="start"><a href="missing.xhtml">Text</a></p>`},
+			want: &validate.Message{Severity: validate.Error, Code: validate.CodeLink,
+				Location: validate.Location{Path: "EPUB/text.xhtml"},
+				Text:     `referenced file "EPUB/missing.xhtml" is missing`},
+		},
+		{
+			name:    "missing fragment",
+			replace: []string{`href="text.xhtml#start"`, `href="text.xhtml#missing"`},
+			want: &validate.Message{Severity: validate.Error, Code: validate.CodeFragment,
+				Location: validate.Location{Path: "EPUB/nav.xhtml"},
+				Text:     `fragment identifier "missing" is not defined in "EPUB/text.xhtml"`},
+		},
+		{
+			name:    "unused resource",
+			replace: []string{`<link rel="stylesheet" href="style.css"/>`, ""},
+			want: &validate.Message{Severity: validate.Warning, Code: validate.CodeUnused,
+				Location: validate.Location{Path: "EPUB/package.opf"},
+				Text:     `manifest item "style.css" is never referenced`},
+		},
+		{
+			name:    "remote link",
+			replace: []string{`<p id="start">Text</p>`, `<p id="start"><a href="https://example.com/">Text</a></p>`},
+		},
+	})
+}
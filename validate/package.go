@@ -0,0 +1,564 @@
+package validate
+
+import (
+	"path"
+	"strings"
+
+	epub "github.com/mdigger/epub3"
+	"github.com/mdigger/epub3/internal/ocf"
+)
+
+// reservedPrefixes lists the prefixes reserved by the EPUB specification that
+// can be used without declaration.
+var reservedPrefixes = map[string]string{
+	"a11y":      "http://www.idpf.org/epub/vocab/package/a11y/#",
+	"dcterms":   "http://purl.org/dc/terms/",
+	"marc":      "http://id.loc.gov/vocabulary/",
+	"media":     "http://www.idpf.org/epub/vocab/overlays/#",
+	"msv":       "http://www.idpf.org/epub/vocab/structure/magazine/#",
+	"onix":      "http://www.editeur.org/ONIX/book/codelists/current.html#",
+	"prism":     "http://www.prismstandard.org/specifications/3.0/PRISM_CV_Spec_3.0.htm#",
+	"rendition": "http://www.idpf.org/vocab/rendition/#",
+	"schema":    "http://schema.org/",
+	"xsd":       "http://www.w3.org/2001/XMLSchema#",
+}
+
+// vocabulary is the set of property values of the default vocabulary.
+type vocabulary map[string]bool
+
+// Default vocabularies of the package document properties.
+var (
+	metaProperties = vocabulary{
+		"alternate-script": true, "authority": true, "belongs-to-collection": true,
+		"collection-type": true, "display-seq": true, "file-as": true,
+		"group-position": true, "identifier-type": true, "meta-auth": true,
+		"role": true, "source-of": true, "term": true, "title-type": true,
+	}
+	linkRelations = vocabulary{
+		"alternate": true, "marc21xml-record": true, "mods-record": true,
+		"onix-record": true, "record": true, "voicing": true,
+		"xml-signature": true, "xmp-record": true,
+	}
+	itemProperties = vocabulary{
+		"cover-image": true, "mathml": true, "nav": true, "remote-resources": true,
+		"scripted": true, "svg": true, "switch": true,
+		// EPUB Dictionaries and Glossaries, EPUB Indexes
+		"dictionary": true, "glossary": true, "search-key-map": true, "index": true,
+	}
+	itemrefProperties = vocabulary{
+		"page-spread-left": true, "page-spread-right": true,
+	}
+)
+
+// coreMediaTypes lists the media types of the publication resources that
+// reading systems must support.
+var coreMediaTypes = map[string]bool{
+	"application/xhtml+xml":       true,
+	"application/x-dtbncx+xml":    true,
+	"application/smil+xml":        true,
+	"application/pls+xml":         true,
+	"application/javascript":      true,
+	"application/ecmascript":      true,
+	"text/javascript":             true,
+	"text/css":                    true,
+	"image/gif":                   true,
+	"image/jpeg":                  true,
+	"image/png":                   true,
+	"image/svg+xml":               true,
+	"image/webp":                  true,
+	"audio/mpeg":                  true,
+	"audio/mp4":                   true,
+	"audio/ogg":                   true,
+	"font/ttf":                    true,
+	"font/otf":                    true,
+	"font/woff":                   true,
+	"font/woff2":                  true,
+	"application/font-sfnt":       true,
+	"application/font-woff":       true,
+	"application/vnd.ms-opentype": true,
+}
+
+// isContentDocument returns true if the media type is the type of EPUB content
+// document that can be used in the spine.
+func isContentDocument(mediaType string) bool {
+	return mediaType == "application/xhtml+xml" || mediaType == "image/svg+xml"
+}
+
+// pkgChecker checks the package document.
+type pkgChecker struct {
+	*validator
+	pkg      *epub.Package
+	location Location             // location of the package document
+	root     string               // folder of the package document
+	ids      map[string]bool      // identifiers of the package elements
+	prefixes map[string]string    // declared prefixes
+	items    map[string]epub.Item // manifest items by ID
+}
+
+// checkPackage checks the package document with the given name. The
+// publication resources are checked only if the file system is defined.
+func (v *validator) checkPackage(pkg *epub.Package, name string) error {
+	c := &pkgChecker{
+		validator: v,
+		pkg:       pkg,
+		location:  Location{Path: name},
+		root:      path.Dir(name),
+		ids:       make(map[string]bool),
+		prefixes:  make(map[string]string),
+		items:     make(map[string]epub.Item, len(pkg.Manifest.Items)),
+	}
+	c.checkIDs()
+	c.checkPrefixes()
+	c.checkMetadata()
+	if err := c.checkManifest(); err != nil {
+		return err
+	}
+	c.checkSpine()
+	if err := c.checkNav(); err != nil {
+		return err
+	}
+	return c.checkLinks()
+}
+
+// checkIDs checks that identifiers of the package elements are unique.
+func (c *pkgChecker) checkIDs() {
+	add := func(id string) {
+		if id == "" {
+			return
+		}
+		if c.ids[id] {
+			c.add(Error, CodeID, c.location, "duplicate id %q", id)
+		}
+		c.ids[id] = true
+	}
+	var addMetadata func(metadata *epub.Metadata)
+	addMetadata = func(metadata *epub.Metadata) {
+		for _, list := range [][]epub.Element{
+			metadata.Identifier, metadata.Language, metadata.Type,
+			metadata.Format, metadata.Source,
+		} {
+			for _, item := range list {
+				add(item.ID)
+			}
+		}
+		if metadata.Date != nil {
+			add(metadata.Date.ID)
+		}
+		for _, list := range [][]epub.ElementLang{
+			metadata.Title, metadata.Creator, metadata.Contributor,
+			metadata.Subject, metadata.Description, metadata.Publisher,
+			metadata.Relation, metadata.Coverage, metadata.Rights,
+		} {
+			for _, item := range list {
+				add(item.ID)
+			}
+		}
+		for _, item := range metadata.Meta {
+			add(item.ID)
+		}
+		for _, item := range metadata.Link {
+			add(item.ID)
+		}
+	}
+	var addCollections func(collections []*epub.Collection)
+	addCollections = func(collections []*epub.Collection) {
+		for _, collection := range collections {
+			add(collection.ID)
+			if collection.Metadata != nil {
+				addMetadata(collection.Metadata)
+			}
+			addCollections(collection.Collections)
+		}
+	}
+
+	add(c.pkg.ID)
+	addMetadata(&c.pkg.Metadata)
+	add(c.pkg.Manifest.ID)
+	for _, item := range c.pkg.Manifest.Items {
+		add(item.ID)
+	}
+	add(c.pkg.Spine.ID)
+	for _, itemref := range c.pkg.Spine.ItemRefs {
+		add(itemref.ID)
+	}
+	addCollections(c.pkg.Collections)
+}
+
+// checkPrefixes checks the prefix declarations of the package.
+func (c *pkgChecker) checkPrefixes() {
+	fields := strings.Fields(c.pkg.Prefix)
+	for i := 0; i < len(fields); i += 2 {
+		prefix := fields[i]
+		if !strings.HasSuffix(prefix, ":") || i+1 == len(fields) {
+			c.add(Error, CodePrefix, c.location, "malformed prefix declaration %q", c.pkg.Prefix)
+			return
+		}
+		prefix = strings.TrimSuffix(prefix, ":")
+		uri := fields[i+1]
+		switch reserved, ok := reservedPrefixes[prefix]; {
+		case prefix == "_":
+			c.add(Error, CodePrefix, c.location, "prefix “_” must not be declared")
+		case ok && reserved != uri:
+			c.add(Error, CodePrefix, c.location, "reserved prefix %q must not be mapped to %q",
+				prefix, uri)
+		case ok:
+			c.add(Warning, CodePrefix, c.location, "reserved prefix %q should not be declared",
+				prefix)
+		}
+		if _, ok := c.prefixes[prefix]; ok {
+			c.add(Error, CodePrefix, c.location, "prefix %q is declared more than once", prefix)
+		}
+		c.prefixes[prefix] = uri
+	}
+}
+
+// checkProperties checks the space-separated list of property values. The
+// unprefixed values must belong to the vocabulary.
+func (c *pkgChecker) checkProperties(name, value string, vocab vocabulary) {
+	for _, property := range strings.Fields(value) {
+		if prefix, _, ok := strings.Cut(property, ":"); ok {
+			if _, declared := c.prefixes[prefix]; !declared && reservedPrefixes[prefix] == "" {
+				c.add(Error, CodePrefix, c.location, "%s %q: undeclared prefix %q",
+					name, property, prefix)
+			}
+			continue
+		}
+		if vocab != nil && !vocab[property] {
+			c.add(Error, CodeProperty, c.location, "%s %q is not defined in the default vocabulary",
+				name, property)
+		}
+	}
+}
+
+// checkRefines checks that the refines attribute refers to the existing
+// element or publication resource.
+func (c *pkgChecker) checkRefines(name, refines string) {
+	if id, ok := strings.CutPrefix(refines, "#"); ok && !c.ids[id] {
+		c.add(Error, CodeID, c.location, "%s refines missing element %q", name, refines)
+	}
+}
+
+// checkMetadata checks the required metadata.
+func (c *pkgChecker) checkMetadata() {
+	if !strings.HasPrefix(c.pkg.Version, "3.") {
+		c.add(Error, CodeMetadata, c.location, "package version must be “3.0”, found %q",
+			c.pkg.Version)
+	}
+	metadata := &c.pkg.Metadata
+
+	// identifier
+	var uid bool
+	for _, item := range metadata.Identifier {
+		if strings.TrimSpace(item.Value) == "" {
+			c.add(Error, CodeMetadata, c.location, "dc:identifier must not be empty")
+		}
+		if item.ID != "" && item.ID == c.pkg.UniqueIdentifier {
+			uid = true
+		}
+	}
+	switch {
+	case len(metadata.Identifier) == 0:
+		c.add(Error, CodeMetadata, c.location, "dc:identifier is required")
+	case !uid:
+		c.add(Error, CodeMetadata, c.location,
+			"unique-identifier %q does not refer to dc:identifier", c.pkg.UniqueIdentifier)
+	}
+
+	// title
+	if len(metadata.Title) == 0 {
+		c.add(Error, CodeMetadata, c.location, "dc:title is required")
+	}
+	for _, item := range metadata.Title {
+		if strings.TrimSpace(item.Value) == "" {
+			c.add(Error, CodeMetadata, c.location, "dc:title must not be empty")
+		}
+	}
+
+	// language
+	if len(metadata.Language) == 0 {
+		c.add(Error, CodeMetadata, c.location, "dc:language is required")
+	}
+	for _, err := range metadata.CheckLang() {
+		c.add(Error, CodeMetadata, c.location, "%v", err)
+	}
+
+	// dates
+	var modified int
+	for _, item := range metadata.Meta {
+		if item.Property == "dcterms:modified" && item.Refines == "" {
+			modified++
+		}
+	}
+	switch {
+	case modified == 0:
+		c.add(Error, CodeMetadata, c.location, "dcterms:modified is required")
+	case modified > 1:
+		c.add(Error, CodeMetadata, c.location, "dcterms:modified must be defined only once")
+	}
+	if _, err := metadata.Modified(); err != nil {
+		c.add(Error, CodeMetadata, c.location, "dcterms:modified: %v", err)
+	}
+	if _, err := metadata.PublicationDate(); err != nil {
+		c.add(Warning, CodeMetadata, c.location, "dc:date: %v", err)
+	}
+
+	// meta & link
+	for _, item := range metadata.Meta {
+		if item.Name != "" && item.Property == "" {
+			continue // EPUB 2 meta kept for compatibility
+		}
+		name := "meta property"
+		switch strings.Count(item.Property, " ") {
+		case 0:
+			c.checkProperties(name, item.Property, metaProperties)
+		default:
+			c.add(Error, CodeProperty, c.location, "%s %q must be a single value",
+				name, item.Property)
+		}
+		if item.Property == "" {
+			c.add(Error, CodeProperty, c.location, "meta property is required")
+		}
+		c.checkProperties("meta scheme", item.Scheme, nil)
+		c.checkRefines("meta "+item.Property, item.Refines)
+	}
+	for _, item := range metadata.Link {
+		c.checkProperties("link rel", item.Rel, linkRelations)
+		c.checkRefines("link "+item.Href, item.Refines)
+		if item.Href == "" {
+			c.add(Error, CodeMetadata, c.location, "link href is required")
+		}
+		if strings.TrimSpace(item.Rel) == "" {
+			c.add(Error, CodeProperty, c.location, "link %s rel is required", item.Href)
+		}
+	}
+}
+
+// checkManifest checks the manifest items and their resources.
+func (c *pkgChecker) checkManifest() error {
+	hrefs := make(map[string]bool, len(c.pkg.Manifest.Items))
+	var nav, cover int
+	for _, item := range c.pkg.Manifest.Items {
+		switch {
+		case item.ID == "":
+			c.add(Error, CodeManifest, c.location, "manifest item %q has no id", item.Href)
+		case item.Href == "":
+			c.add(Error, CodeManifest, c.location, "manifest item %q has no href", item.ID)
+		case item.MediaType == "":
+			c.add(Error, CodeManifest, c.location, "manifest item %q has no media type", item.Href)
+		}
+		c.items[item.ID] = item
+		c.checkProperties("manifest item "+item.Href+" property", item.Properties, itemProperties)
+		for _, property := range strings.Fields(item.Properties) {
+			switch property {
+			case "nav":
+				nav++
+				if item.MediaType != "application/xhtml+xml" {
+					c.add(Error, CodeNav, c.location,
+						"navigation document %q must be XHTML content document", item.Href)
+				}
+			case "cover-image":
+				cover++
+				if !strings.HasPrefix(item.MediaType, "image/") {
+					c.add(Error, CodeManifest, c.location, "cover image %q must be an image",
+						item.Href)
+				}
+			}
+		}
+
+		// check resource
+		name, ok := ocf.Resolve(c.root, item.Href)
+		if !ok {
+			continue // remote resource
+		}
+		if hrefs[name] {
+			c.add(Error, CodeManifest, c.location, "duplicate manifest item %q", item.Href)
+		}
+		hrefs[name] = true
+		if name == c.location.Path && c.location.Path != "" {
+			c.add(Error, CodeManifest, c.location, "package document must not be listed in the manifest")
+		}
+		if c.fsys == nil {
+			continue
+		}
+		if _, ok, err := c.readFile(name); err != nil {
+			return err
+		} else if !ok {
+			c.add(Error, CodeResource, c.location, "manifest item %q is missing", item.Href)
+		}
+	}
+	switch {
+	case nav == 0:
+		c.add(Error, CodeNav, c.location, "navigation document is required")
+	case nav > 1:
+		c.add(Error, CodeNav, c.location, "only one navigation document is allowed")
+	}
+	if cover > 1 {
+		c.add(Error, CodeManifest, c.location, "only one cover image is allowed")
+	}
+
+	// check fallbacks and media overlays
+	for _, item := range c.pkg.Manifest.Items {
+		if item.Fallback != "" {
+			if _, ok := c.items[item.Fallback]; !ok {
+				c.add(Error, CodeID, c.location, "manifest item %q fallback %q is not found",
+					item.Href, item.Fallback)
+				continue
+			}
+			if _, ok := c.fallback(item, func(mediaType string) bool { return false }); !ok {
+				c.add(Error, CodeMediaType, c.location, "manifest item %q has circular fallback chain",
+					item.Href)
+				continue
+			}
+		}
+		if item.MediaOverlay != "" {
+			overlay, ok := c.items[item.MediaOverlay]
+			switch {
+			case !ok:
+				c.add(Error, CodeID, c.location, "manifest item %q media overlay %q is not found",
+					item.Href, item.MediaOverlay)
+			case overlay.MediaType != "application/smil+xml":
+				c.add(Error, CodeMediaType, c.location,
+					"media overlay %q of manifest item %q must be SMIL document",
+					overlay.Href, item.Href)
+			}
+		}
+		// the Search Key Map is processed by reading systems supporting
+		// dictionaries and needs no fallback
+		if !coreMediaTypes[item.MediaType] && item.MediaType != "" &&
+			item.MediaType != epub.SearchKeyMapType {
+			if found, _ := c.fallback(item, func(mediaType string) bool {
+				return coreMediaTypes[mediaType]
+			}); !found {
+				c.add(Warning, CodeMediaType, c.location,
+					"manifest item %q has foreign media type %q without fallback to a core media type",
+					item.Href, item.MediaType)
+			}
+		}
+	}
+	return nil
+}
+
+// fallback follows the fallback chain of the manifest item and returns true if
+// the item or its fallback has the suitable media type. The second value is
+// false if the chain is circular.
+func (c *pkgChecker) fallback(item epub.Item, suitable func(mediaType string) bool) (bool, bool) {
+	visited := make(map[string]bool)
+	for {
+		if suitable(item.MediaType) {
+			return true, true
+		}
+		if item.Fallback == "" {
+			return false, true
+		}
+		if visited[item.ID] {
+			return false, false
+		}
+		visited[item.ID] = true
+		next, ok := c.items[item.Fallback]
+		if !ok {
+			return false, true
+		}
+		item = next
+	}
+}
+
+// checkSpine checks the spine items.
+func (c *pkgChecker) checkSpine() {
+	spine := c.pkg.Spine
+	switch spine.PageDirection {
+	case "", "ltr", "rtl", "default":
+	default:
+		c.add(Error, CodeSpine, c.location, "bad page-progression-direction %q",
+			spine.PageDirection)
+	}
+	if spine.Toc != "" {
+		if item, ok := c.items[spine.Toc]; !ok {
+			c.add(Error, CodeID, c.location, "spine toc %q is not found in the manifest", spine.Toc)
+		} else if item.MediaType != "application/x-dtbncx+xml" {
+			c.add(Error, CodeMediaType, c.location, "spine toc %q must be NCX document", item.Href)
+		}
+	}
+	if len(spine.ItemRefs) == 0 {
+		c.add(Error, CodeSpine, c.location, "spine must contain at least one itemref")
+		return
+	}
+	var linear bool
+	refs := make(map[string]bool, len(spine.ItemRefs))
+	for _, itemref := range spine.ItemRefs {
+		c.checkProperties("spine itemref "+itemref.IDRef+" property", itemref.Properties,
+			itemrefProperties)
+		switch itemref.Linear {
+		case "", "yes":
+			linear = true
+		case "no":
+		default:
+			c.add(Error, CodeSpine, c.location, "spine itemref %q has bad linear value %q",
+				itemref.IDRef, itemref.Linear)
+		}
+		if refs[itemref.IDRef] {
+			c.add(Error, CodeSpine, c.location, "duplicate spine itemref %q", itemref.IDRef)
+		}
+		refs[itemref.IDRef] = true
+		item, ok := c.items[itemref.IDRef]
+		if !ok {
+			c.add(Error, CodeSpine, c.location, "spine itemref %q is not found in the manifest",
+				itemref.IDRef)
+			continue
+		}
+		if found, _ := c.fallback(item, isContentDocument); !found {
+			c.add(Error, CodeMediaType, c.location,
+				"spine item %q of type %q has no fallback to a content document",
+				item.Href, item.MediaType)
+		}
+	}
+	if !linear {
+		c.add(Error, CodeSpine, c.location, "spine must contain at least one linear itemref")
+	}
+}
+
+// checkNav checks that the navigation document contains the table of
+// contents.
+func (c *pkgChecker) checkNav() error {
+	if c.fsys == nil {
+		return nil
+	}
+	for _, item := range c.pkg.Manifest.Items {
+		if !hasProperty(item.Properties, "nav") {
+			continue
+		}
+		name, ok := ocf.Resolve(c.root, item.Href)
+		if !ok {
+			c.add(Error, CodeNav, c.location, "navigation document %q must be local", item.Href)
+			continue
+		}
+		doc, err := c.document(name, item.MediaType)
+		if err != nil || doc == nil || doc.ids == nil {
+			return err // missing and malformed files are reported separately
+		}
+		var toc bool
+		for _, typ := range doc.navs {
+			if hasProperty(typ, "toc") {
+				toc = true
+			}
+		}
+		if !toc {
+			c.add(Error, CodeNav, Location{Path: name},
+				"navigation document must contain nav element with epub:type “toc”")
+		}
+	}
+	return nil
+}
+
+// nsOPS is the namespace of the EPUB structural semantics attributes.
+const nsOPS = "http://www.idpf.org/2007/ops"
+
+// hasProperty returns true if the space-separated list of properties contains
+// the property.
+func hasProperty(properties, property string) bool {
+	for _, value := range strings.Fields(properties) {
+		if value == property {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+package validate_test
+
+import (
+	"testing"
+
+	"github.com/mdigger/epub3/validate"
+)
+
+func TestPackage(t *testing.T) {
+	location := validate.Location{Path: "EPUB/package.opf"}
+	testValidate(t, []validateTest{
+		{
+			name:    "missing modified",
+			replace: []string{`<meta property="dcterms:modified">2020-01-02T03:04:05Z</meta>`, ""},
+			want: &validate.Message{Severity: validate.Error, Code: validate.CodeMetadata,
+				Location: location, Text: "dcterms:modified is required"},
+		},
+		{
+			name:    "broken itemref",
+			replace: []string{`<itemref idref="text"/>`, `<itemref idref="text"/><itemref idref="missing"/>`},
+			want: &validate.Message{Severity: validate.Error, Code: validate.CodeSpine,
+				Location: location, Text: `spine itemref "missing" is not found in the manifest`},
+		},
+		{
+			name:    "broken refines",
+			replace: []string{`refines="#title"`, `refines="#missing"`},
+			want: &validate.Message{Severity: validate.Error, Code: validate.CodeID,
+				Location: location, Text: `meta title-type refines missing element "#missing"`},
+		},
+		{
+			name:    "broken fallback",
+			replace: []string{`media-type="text/css"/>`, `media-type="text/css" fallback="missing"/>`},
+			want: &validate.Message{Severity: validate.Error, Code: validate.CodeID,
+				Location: location, Text: `manifest item "style.css" fallback "missing" is not found`},
+		},
+		{
+			name: "missing resource",
+			replace: []string{`href="style.css"/>`, `href="style.css"/><link rel="stylesheet" href="missing.css"/>`,
+				`media-type="text/css"/>`, `media-type="text/css"/><item id="missing" href="missing.css" media-type="text/css"/>`},
+			want: &validate.Message{Severity: validate.Error, Code: validate.CodeResource,
+				Location: location, Text: `manifest item "missing.css" is missing`},
+		},
+		{
+			name:    "unknown property",
+			replace: []string{`properties="nav"`, `properties="nav foo"`},
+			want: &validate.Message{Severity: validate.Error, Code: validate.CodeProperty,
+				Location: location, Text: `manifest item nav.xhtml property "foo" is not defined in the default vocabulary`},
+		},
+		{
+			name:    "dictionary property",
+			replace: []string{`media-type="application/xhtml+xml"/>`, `media-type="application/xhtml+xml" properties="dictionary index"/>`},
+		},
+	})
+}
@@ -0,0 +1,241 @@
+// Package validate checks EPUB publications for conformance with the EPUB 3
+// specification, similar to epubcheck: the container structure, the package
+// documents and the references to publication resources.
+package validate
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+
+	epub "github.com/mdigger/epub3"
+)
+
+// Severity describes the importance of the validation message.
+type Severity byte
+
+// Supported severities of the validation messages.
+const (
+	Error   Severity = iota // The publication does not conform to the specification
+	Warning                 // The publication may not be rendered as intended
+	Info                    // Informational message
+)
+
+// String returns the name of the severity.
+func (s Severity) String() string {
+	switch s {
+	case Error:
+		return "ERROR"
+	case Warning:
+		return "WARNING"
+	default:
+		return "INFO"
+	}
+}
+
+// Code identifies the kind of the validation check.
+type Code string
+
+// Validation codes.
+const (
+	CodeMimetype  Code = "mimetype"   // mimetype file
+	CodeContainer Code = "container"  // container file
+	CodeParse     Code = "parse"      // malformed XML document
+	CodeMetadata  Code = "metadata"   // required metadata
+	CodeID        Code = "id"         // unique identifiers and references to them
+	CodeManifest  Code = "manifest"   // manifest items
+	CodeResource  Code = "resource"   // publication resources
+	CodeSpine     Code = "spine"      // spine items
+	CodeNav       Code = "nav"        // navigation document
+	CodeMediaType Code = "media-type" // core media types and fallbacks
+	CodeProperty  Code = "property"   // property values
+	CodePrefix    Code = "prefix"     // prefix declarations
+	CodeLink      Code = "link"       // references to publication resources
+	CodeFragment  Code = "fragment"   // fragment identifiers of references
+	CodeUnused    Code = "unused"     // resources that are never referenced
+)
+
+// Location describes the place of the problem in the publication.
+type Location struct {
+	Path   string // Name of the file in the container.
+	Line   int    // Line number in the file, if known.
+	Column int    // Column number in the line, if known.
+}
+
+// String returns the location in the form “path:line:column”.
+func (l Location) String() string {
+	switch {
+	case l.Column > 0:
+		return fmt.Sprintf("%s:%d:%d", l.Path, l.Line, l.Column)
+	case l.Line > 0:
+		return fmt.Sprintf("%s:%d", l.Path, l.Line)
+	default:
+		return l.Path
+	}
+}
+
+// Message describes the problem found in the publication.
+type Message struct {
+	Severity Severity // Importance of the problem.
+	Code     Code     // Kind of the check.
+	Location Location // Place of the problem.
+	Text     string   // Description of the problem.
+}
+
+// String returns the message in the form “ERROR(code) path:line: text”.
+func (m Message) String() string {
+	if m.Location.Path == "" {
+		return fmt.Sprintf("%s(%s): %s", m.Severity, m.Code, m.Text)
+	}
+	return fmt.Sprintf("%s(%s) %s: %s", m.Severity, m.Code, m.Location, m.Text)
+}
+
+// HasErrors returns true if the list contains messages with Error severity.
+func HasErrors(messages []Message) bool {
+	for _, msg := range messages {
+		if msg.Severity == Error {
+			return true
+		}
+	}
+	return false
+}
+
+// Zip validates the publication in the zip container: in addition to the
+// checks of FS, it checks that the mimetype file is the first entry of the
+// container and is stored uncompressed without extra fields. The returned
+// error describes a container that can't be read.
+func Zip(r io.ReaderAt, size int64) ([]Message, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	v := new(validator)
+	switch {
+	case len(zr.File) == 0 || zr.File[0].Name != "mimetype":
+		v.add(Error, CodeMimetype, Location{}, "mimetype file must be the first entry of the container")
+	case zr.File[0].Method != zip.Store:
+		v.add(Error, CodeMimetype, Location{Path: "mimetype"}, "mimetype file must be stored uncompressed")
+	case len(zr.File[0].Extra) > 0:
+		v.add(Error, CodeMimetype, Location{Path: "mimetype"}, "mimetype file must not have extra fields")
+	}
+	return v.validate(zr)
+}
+
+// FS validates the publication files in the file system, such as the unpacked
+// publication directory os.DirFS(dir). The references of XHTML, SVG and CSS
+// resources are resolved and checked too. The returned error describes a file
+// that can't be read.
+func FS(fsys fs.FS) ([]Message, error) {
+	return new(validator).validate(fsys)
+}
+
+// Package validates the package document without its resources.
+func Package(pkg *epub.Package) []Message {
+	v := new(validator)
+	v.checkPackage(pkg, "")
+	return v.messages
+}
+
+// validator collects the validation messages.
+type validator struct {
+	fsys     fs.FS                // publication files
+	docs     map[string]*document // parsed publication resources
+	messages []Message            // found problems
+}
+
+// add adds the validation message.
+func (v *validator) add(severity Severity, code Code, location Location, format string, args ...interface{}) {
+	v.messages = append(v.messages, Message{
+		Severity: severity,
+		Code:     code,
+		Location: location,
+		Text:     fmt.Sprintf(format, args...),
+	})
+}
+
+// parseError adds the message about the malformed XML document.
+func (v *validator) parseError(name string, err error) {
+	location := Location{Path: name}
+	var syntaxErr *xml.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		location.Line = syntaxErr.Line
+		err = errors.New(syntaxErr.Msg)
+	}
+	v.add(Error, CodeParse, location, "%v", err)
+}
+
+// readFile returns the content of the publication file. Returns false if the
+// file does not exist.
+func (v *validator) readFile(name string) ([]byte, bool, error) {
+	data, err := fs.ReadFile(v.fsys, name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, false, nil
+	}
+	return data, err == nil, err
+}
+
+// validate checks the publication files.
+func (v *validator) validate(fsys fs.FS) ([]Message, error) {
+	v.fsys = fsys
+
+	// check mimetype
+	data, ok, err := v.readFile("mimetype")
+	switch {
+	case err != nil:
+		return nil, err
+	case !ok:
+		v.add(Error, CodeMimetype, Location{}, "mimetype file is missing")
+	case string(data) != "application/epub+zip":
+		v.add(Error, CodeMimetype, Location{Path: "mimetype"},
+			"mimetype file must contain “application/epub+zip”, found %q", data)
+	}
+
+	// check container
+	data, ok, err = v.readFile(epub.ContainerFilename)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		v.add(Error, CodeContainer, Location{}, "%s file is missing", epub.ContainerFilename)
+		return v.messages, nil
+	}
+	container, err := epub.ReadContainer(bytes.NewReader(data))
+	if err != nil {
+		v.parseError(epub.ContainerFilename, err)
+		return v.messages, nil
+	}
+	location := Location{Path: epub.ContainerFilename}
+	if len(container.Rootfiles) == 0 {
+		v.add(Error, CodeContainer, location, "no rootfile element")
+	}
+
+	// check packages
+	for _, rootfile := range container.Rootfiles {
+		if rootfile.MediaType != "application/oebps-package+xml" {
+			v.add(Error, CodeContainer, location, "rootfile %q has bad media type %q",
+				rootfile.FullPath, rootfile.MediaType)
+		}
+		data, ok, err := v.readFile(rootfile.FullPath)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			v.add(Error, CodeContainer, location, "package document %q is missing",
+				rootfile.FullPath)
+			continue
+		}
+		pkg, err := epub.ReadPackage(bytes.NewReader(data))
+		if err != nil {
+			v.parseError(rootfile.FullPath, err)
+			continue
+		}
+		if err := v.checkPackage(pkg, rootfile.FullPath); err != nil {
+			return nil, err
+		}
+	}
+	return v.messages, nil
+}
@@ -0,0 +1,174 @@
+package validate_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	epub "github.com/mdigger/epub3"
+	"github.com/mdigger/epub3/validate"
+)
+
+// testDocument returns the content document with the body content.
+func testDocument(title, body string) string {
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" xml:lang="en">
+<head><title>` + title + `</title></head>
+<body>` + body + `</body>
+</html>`
+}
+
+// testPackage is the package document of the valid publication made by
+// testFS.
+const testPackage = `<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="uid">
+<metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+<dc:identifier id="uid">urn:uuid:a5e1a3a4-8a3e-4c7e-9a7c-5b1c2c3d4e5f</dc:identifier>
+<dc:title id="title">Test</dc:title>
+<dc:language>en</dc:language>
+<meta property="title-type" refines="#title">main</meta>
+<meta property="dcterms:modified">2020-01-02T03:04:05Z</meta>
+</metadata>
+<manifest>
+<item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+<item id="text" href="text.xhtml" media-type="application/xhtml+xml"/>
+<item id="style" href="style.css" media-type="text/css"/>
+</manifest>
+<spine>
+<itemref idref="text"/>
+</spine>
+</package>`
+
+// testFS returns the files of the valid publication. The replacer, if not
+// nil, is applied to all files.
+func testFS(replacer *strings.Replacer) fstest.MapFS {
+	files := map[string]string{
+		"mimetype": "application/epub+zip",
+		"META-INF/container.xml": `<?xml version="1.0" encoding="UTF-8"?>
+<container xmlns="urn:oasis:names:tc:opendocument:xmlns:container" version="1.0">
+<rootfiles><rootfile full-path="EPUB/package.opf" media-type="application/oebps-package+xml"/></rootfiles>
+</container>`,
+		"EPUB/package.opf": testPackage,
+		"EPUB/nav.xhtml": testDocument("Contents",
+			`<nav epub:type="toc"><ol><li><a href="text.xhtml#start">Text</a></li></ol></nav>`),
+		"EPUB/text.xhtml": strings.Replace(testDocument("Text", `<p id="start">Text</p>`),
+			"</title>", `</title><link rel="stylesheet" href="style.css"/>`, 1),
+		"EPUB/style.css": "p { margin: 0 }",
+	}
+	fsys := make(fstest.MapFS, len(files))
+	for name, data := range files {
+		if replacer != nil {
+			data = replacer.Replace(data)
+		}
+		fsys[name] = &fstest.MapFile{Data: []byte(data)}
+	}
+	return fsys
+}
+
+// testValidate checks that the validation of the publication made by testFS
+// with the replacements returns exactly the expected message.
+func testValidate(t *testing.T, tests []validateTest) {
+	t.Helper()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var replacer *strings.Replacer
+			if len(test.replace) > 0 {
+				replacer = strings.NewReplacer(test.replace...)
+			}
+			messages, err := validate.FS(testFS(replacer))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var want []validate.Message
+			if test.want != nil {
+				want = append(want, *test.want)
+			}
+			if len(messages) != len(want) {
+				t.Fatalf("messages = %v, want %v", messages, want)
+			}
+			for i, msg := range messages {
+				msg.Location.Line, msg.Location.Column = 0, 0
+				if msg != want[i] {
+					t.Errorf("message = %v, want %v", msg, want[i])
+				}
+			}
+		})
+	}
+}
+
+// validateTest describes the publication with a problem.
+type validateTest struct {
+	name    string            // name of the test
+	replace []string          // old, new pairs of replacements in the files
+	want    *validate.Message // expected message (without line and column)
+}
+
+func TestValid(t *testing.T) {
+	testValidate(t, []validateTest{{name: "valid"}})
+}
+
+func TestDictionaryAndIndex(t *testing.T) {
+	var buf bytes.Buffer
+	pub, err := epub.New(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub.AddTitle("Dictionary")
+	pub.Language = []epub.Element{{Value: "en"}}
+	files := []struct {
+		name, body string
+		properties []string
+	}{
+		{"words.xhtml", `<dl><dt id="apple">apple</dt><dd>A fruit.</dd></dl>`, []string{"dictionary"}},
+		{"terms.xhtml", `<dl><dt id="pear">pear</dt><dd>A fruit.</dd></dl>`, []string{"glossary"}},
+		{"text.xhtml", `<p id="p1">An apple and a pear.</p>`, nil},
+	}
+	for _, file := range files {
+		if err := pub.AddContent(strings.NewReader(testDocument(file.name, file.body)),
+			file.name, epub.Primary, file.properties...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := pub.AddDictionary("words.xml", epub.Dictionary{
+		Title:      "Words",
+		SourceLang: "en",
+		TargetLang: "en",
+		Content:    []string{"words.xhtml"},
+		Keys: []epub.SearchKeyGroup{{
+			Href:    "words.xhtml#apple",
+			Matches: []epub.SearchKeyMatch{{Value: "apple"}},
+		}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := pub.AddGlossary("terms.xml", epub.Dictionary{
+		SourceLang: "en",
+		Content:    []string{"terms.xhtml"},
+		Keys: []epub.SearchKeyGroup{{
+			Href:    "terms.xhtml#pear",
+			Matches: []epub.SearchKeyMatch{{Value: "pear"}},
+		}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	idx := &epub.Index{}
+	idx.Add("text.xhtml#p1", "fruit", "apple")
+	idx.Add("text.xhtml#p1", "fruit", "pear")
+	if err := pub.AddIndex("index.xhtml", idx); err != nil {
+		t.Fatal(err)
+	}
+	pub.AddTOC("Text", "text.xhtml")
+	if err := pub.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	messages, err := validate.Zip(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, msg := range messages {
+		t.Error(msg)
+	}
+}
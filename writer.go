@@ -1,46 +1,66 @@
 package epub
 
 import (
-	"archive/zip"
+	"context"
 	"encoding/xml"
-	"fmt"
 	"io"
 	"path"
-	"path/filepath"
-	"strings"
-	"time"
-)
-
-// Default metadata settings.
-var (
-	DefaultLang  = Element{Value: "en"}
-	DefaultTitle = ElementLang{Value: "Untitled"}
+	"sync"
 )
 
 // Writer allows you to create publications in epub 3 format.
 type Writer struct {
-	Metadata
-	zipWriter *zip.Writer
-	manifest  []Item
-	spine     []ItemRef
-	counter   uint
+	*Rendition // default publication rendition
+	config
+	sink       Sink                // publication files destination
+	renditions []*Rendition        // all publication renditions
+	mapping    [][]MappingLocation // rendition mapping units
+	mu         sync.Mutex          // protects renditions content
+	wg         sync.WaitGroup      // files passed to the parallel workers
+	jobs       chan *pendingFile   // files compressed by the parallel workers
+	pending    []*pendingFile      // files prepared in parallel mode
+	written    int64               // total number of written bytes
+	failed     error               // error of writing the content to the sink
 }
 
 // New return new epub publication Writer.
-func New(w io.Writer) (wr *Writer, err error) {
-	zipWriter := zip.NewWriter(w) // create zip-compressor
-	// close zip writer on error
+func New(w io.Writer, opts ...Option) (*Writer, error) {
+	cfg := newConfig(opts)
+	return newWriter(newZipSink(w, cfg.modTime), cfg)
+}
+
+// NewDir return new epub publication Writer that writes unpacked publication
+// files to the directory.
+func NewDir(dir string, opts ...Option) (*Writer, error) {
+	cfg := newConfig(opts)
+	return newWriter(&dirSink{dir: dir, modTime: cfg.modTime}, cfg)
+}
+
+// NewSink return new epub publication Writer that writes publication files to
+// the Sink.
+func NewSink(sink Sink, opts ...Option) (*Writer, error) {
+	return newWriter(sink, newConfig(opts))
+}
+
+// newWriter return new epub publication Writer with the given settings.
+func newWriter(sink Sink, cfg config) (wr *Writer, err error) {
+	wr = &Writer{
+		config: cfg,
+		sink:   sink,
+	}
+	if cfg.workers > 0 {
+		wr.startWorkers(cfg.workers)
+	}
+	wr.Rendition = wr.newRendition(cfg.contentDir, Selection{})
+	// abort writing on error
 	defer func() {
 		if err != nil {
-			zipWriter.Close()
+			wr.abort()
 		}
 	}()
 
 	// write mimetype header
-	item, err := zipWriter.CreateHeader(&zip.FileHeader{
-		Name:   "mimetype",
-		Method: zip.Store,
-	})
+	item, err := sink.Create("mimetype")
 	if err != nil {
 		return nil, err
 	}
@@ -48,171 +68,171 @@ func New(w io.Writer) (wr *Writer, err error) {
 		return nil, err
 	}
 
-	// write container file
-	if err = addXMLData(zipWriter,
-		"META-INF/container.xml",
-		Container{
-			Version: "1.0",
-			Rootfiles: []RootFile{
-				{
-					FullPath:  path.Join(RootPath, PackageFilename),
-					MediaType: "application/oebps-package+xml",
-				},
-			},
-		}); err != nil {
-		return nil, err
-	}
+	// return initialized Writer
+	return wr, nil
+}
 
-	// return initializer Writer
-	return &Writer{
-		zipWriter: zipWriter,
-		manifest:  make([]Item, 0, 20),
-		spine:     make([]ItemRef, 0, 20),
-	}, nil
+// Close closes the publication and writes metadata. On error the publication
+// is aborted as with Abort.
+func (w *Writer) Close() error {
+	return w.CloseContext(context.Background())
 }
 
-// ContentType describe type of content file.
-type ContentType byte
+// CloseContext is like Close but stops writing the publication and returns the
+// context error when the context is done.
+func (w *Writer) CloseContext(ctx context.Context) error {
+	if err := w.close(ctx); err != nil {
+		w.abort()
+		return err
+	}
 
-// Supported types of content file.
-const (
-	Primary   ContentType = iota // Primary content file
-	Auxiliary                    // Auxiliary content file
-	Media                        // Media file
-)
+	// close publication
+	return w.sink.Close()
+}
 
-// AddContent adds data to the publication.
-func (w *Writer) AddContent(r io.Reader, name string, ct ContentType, properties ...string) error {
-	name = filepath.ToSlash(name) // normalize file name
+// Abort stops writing the publication without the package documents and the
+// container file, for example, when the content can't be added. The zip
+// archive is left without the central directory, so the written data is not
+// a readable publication and should be discarded; other sinks are closed.
+// The temporary files of the parallel mode are removed.
+func (w *Writer) Abort() error {
+	return w.abort()
+}
 
-	// check if already added
-	for _, item := range w.manifest {
-		if item.Href == name {
-			return fmt.Errorf("a file with the name %q has already been added to the publication", name)
-		}
+// abort removes the pending files and closes the sink, except the zip archive,
+// which must not get the central directory of the incomplete publication.
+func (w *Writer) abort() error {
+	w.stopWorkers()
+	for _, file := range w.pending {
+		file.data.Close()
 	}
-
-	// generate file id and add to manifest
-	w.counter++
-	id := fmt.Sprintf("id%02x", w.counter)
-	w.manifest = append(w.manifest, Item{
-		ID:         id,
-		Href:       name,
-		MediaType:  typeByName(name),
-		Properties: strings.Join(properties, " "),
-	})
-
-	// if it content file than add to spine
-	if ct < Media {
-		itemref := ItemRef{IDRef: id}
-		if ct == Auxiliary {
-			itemref.Linear = "no"
-		}
-		w.spine = append(w.spine, itemref)
+	w.pending = nil
+	if _, ok := w.sink.(*zipSink); ok {
+		return nil
 	}
-
-	// write file to publication
-	file, err := w.zipWriter.Create(path.Join(RootPath, name))
-	if err != nil {
-		return err
-	}
-	_, err = io.Copy(file, r)
-
-	return err
+	return w.sink.Close()
 }
 
-// Close closes the publication and writes metadata.
-func (w *Writer) Close() error {
-	metadata := w.Metadata // copy metadata
-	// add DC namespace if not defined
-	if metadata.DC == "" {
-		metadata.DC = "http://purl.org/dc/elements/1.1/"
-	}
-
-	// set global publication UID
-	var uid string
-	for _, item := range metadata.Identifier {
-		if item.ID != "" {
-			uid = item.ID
-			break
+// close writes the packages of all renditions and the container files.
+func (w *Writer) close(ctx context.Context) error {
+	w.wg.Wait() // wait for parallel workers
+	if w.failed != nil {
+		return w.failed
+	}
+	container := Container{
+		Version:   "1.0",
+		Rootfiles: make([]RootFile, 0, len(w.renditions)),
+	}
+	packages := make([]*Package, 0, len(w.renditions))
+	for i, rendition := range w.renditions {
+		var defaults *Metadata // metadata of the default rendition
+		if i > 0 {
+			defaults = &packages[0].Metadata
 		}
+		pkg, err := rendition.build(ctx, defaults)
+		if err != nil {
+			return err
+		}
+		packages = append(packages, pkg)
 	}
-	if uid == "" {
-		// UID not defined
-		metadata.Identifier = append(metadata.Identifier,
-			Element{ID: "uuid", Value: NewUUID()})
-		uid = "uuid"
-	}
-
-	// set modified time
-	var setTime bool
-	for _, item := range metadata.Meta {
-		if item.Property == "dcterms:modified" {
-			item.Value = now()
-			setTime = true
-			break
+	if w.workers > 0 {
+		if err := w.writePending(ctx); err != nil {
+			return err
 		}
 	}
-	if !setTime {
-		// modified time not set
-		metadata.Meta = append(metadata.Meta, Meta{
-			Property: "dcterms:modified",
-			Value:    now(),
+	for i, rendition := range w.renditions {
+		// create & write publication package file
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		name := path.Join(rendition.root, w.packageFilename)
+		if err := w.addXMLData(name, packages[i]); err != nil {
+			return err
+		}
+		container.Rootfiles = append(container.Rootfiles, RootFile{
+			FullPath:  name,
+			MediaType: "application/oebps-package+xml",
+			Selection: rendition.Selection,
 		})
+		if rendition.Selection != (Selection{}) {
+			container.Rendition = nsRendition
+		}
 	}
 
-	// add default language if not defined
-	if len(metadata.Language) == 0 {
-		metadata.Language = []Element{DefaultLang}
-	}
-
-	// add default title if not defined
-	if len(metadata.Title) == 0 {
-		metadata.Title = []ElementLang{DefaultTitle}
+	if len(w.renditions) > 1 {
+		// write release identifier of the multiple-rendition publication
+		metadata := packages[0].Metadata
+		var identifier Element
+		for _, item := range metadata.Identifier {
+			if item.ID == packages[0].UniqueIdentifier {
+				identifier = item
+				break
+			}
+		}
+		identifier.ID = "pub-id"
+		modified, err := metadata.Modified()
+		if err != nil {
+			return err
+		}
+		if err := w.addXMLData(ContainerMetadataFilename, ContainerMetadata{
+			DC:               nsDC,
+			UniqueIdentifier: identifier.ID,
+			Identifier:       []Element{identifier},
+			Meta: []Meta{{
+				Property: "dcterms:modified",
+				Value:    modified.Format(ModifiedLayout),
+			}},
+		}); err != nil {
+			return err
+		}
 	}
 
-	// create & write publication package file
-	if err := addXMLData(w.zipWriter,
-		path.Join(RootPath, PackageFilename),
-		Package{
-			Version:          "3.0",
-			UniqueIdentifier: uid,
-			Metadata:         metadata,
-			Manifest: Manifest{
-				Items: w.manifest,
-			},
-			Spine: Spine{
-				ItemRefs: w.spine,
-			},
-		}); err != nil {
-		w.zipWriter.Close() // close zip writer on error
-		return err
+	if len(w.mapping) > 0 {
+		// write rendition mapping document
+		if err := w.addMapping(); err != nil {
+			return err
+		}
+		container.Links = []ContainerLink{{
+			Href:      MappingFilename,
+			Rel:       "mapping",
+			MediaType: "application/xhtml+xml",
+		}}
 	}
 
-	// close publication
-	return w.zipWriter.Close()
+	// write container file
+	return w.addXMLData(ContainerFilename, container)
 }
 
-// now return string wih current time i RFC 3339 format.
-func now() string {
-	return time.Now().UTC().Format(time.RFC3339)
+// now return string with current time in dcterms:modified format.
+func (w *Writer) now() string {
+	return w.clock().UTC().Format(ModifiedLayout)
 }
 
 // addXMLData serialize & write publication data as XML file.
-func addXMLData(w *zip.Writer, name string, data interface{}) error {
+func (w *Writer) addXMLData(name string, data interface{}) error {
 	// create new publication file
-	item, err := w.Create(name)
+	item, err := w.sink.Create(name)
 	if err != nil {
 		return err
 	}
+	return encodeXML(w.progress(item, name), "", data)
+}
 
+// encodeXML writes the XML header, the optional document type declaration
+// and serialized XML data.
+func encodeXML(w io.Writer, doctype string, data interface{}) error {
 	// add XML header
-	if _, err := io.WriteString(item, xml.Header); err != nil {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
 		return err
 	}
+	if doctype != "" {
+		if _, err := io.WriteString(w, "<!DOCTYPE "+doctype+">\n"); err != nil {
+			return err
+		}
+	}
 
 	// serialize XML data to file
-	enc := xml.NewEncoder(item)
+	enc := xml.NewEncoder(w)
 	enc.Indent("", "\t")
 	return enc.Encode(data)
 }
@@ -0,0 +1,153 @@
+package epub_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	epub "github.com/mdigger/epub3"
+)
+
+// testDocument returns the content document with the title and the text.
+func testDocument(title, text string) string {
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" xml:lang="en">
+<head><title>` + title + `</title></head>
+<body><h1 id="title">` + title + `</h1><p>` + text + `</p></body>
+</html>`
+}
+
+// writeTestPublication writes the publication with two chapters, the cover
+// image and the table of contents.
+func writeTestPublication(t *testing.T, opts ...epub.Option) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	pub, err := epub.New(&buf, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub.AddTitle("Test")
+	pub.AddAuthors("Author")
+	pub.Language = []epub.Element{{Value: "en"}}
+	for _, file := range []struct {
+		name, content string
+		ct            epub.ContentType
+		properties    []string
+	}{
+		{"text/chapter1.xhtml", testDocument("One", "First chapter."), epub.Primary, nil},
+		{"text/chapter2.xhtml", testDocument("Two", "Second chapter."), epub.Primary, nil},
+		{"images/cover.svg", `<svg xmlns="http://www.w3.org/2000/svg"/>`, epub.Media,
+			[]string{"cover-image", "cover-image"}},
+	} {
+		if err := pub.AddContent(strings.NewReader(file.content), file.name, file.ct,
+			file.properties...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pub.AddTOC("One", "text/chapter1.xhtml")
+	pub.AddTOC("Two", "text/chapter2.xhtml")
+	if err := pub.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDeterministic(t *testing.T) {
+	date := time.Date(2021, 3, 15, 10, 20, 30, 0, time.UTC)
+	first := writeTestPublication(t, epub.Deterministic(date))
+	if data := writeTestPublication(t, epub.WithClock(time.Now), epub.Deterministic(date)); !bytes.Equal(data, first) {
+		t.Error("publication differs")
+	}
+	parallel := writeTestPublication(t, epub.Deterministic(date), epub.Parallel(4))
+	for i := 0; i < 5; i++ {
+		if data := writeTestPublication(t, epub.Deterministic(date), epub.Parallel(4)); !bytes.Equal(data, parallel) {
+			t.Error("publication written in parallel differs")
+		}
+	}
+	if data := writeTestPublication(t); bytes.Equal(data, first) {
+		t.Error("publication without Deterministic is the same")
+	}
+	pkg := readTestFile(t, first, "OEBPS/package.opf")
+	if !strings.Contains(pkg, `<meta property="dcterms:modified">2021-03-15T10:20:30Z</meta>`) {
+		t.Error("dcterms:modified is not set from Deterministic")
+	}
+	if !strings.Contains(pkg, `properties="cover-image">`) {
+		t.Error("duplicate properties are not removed")
+	}
+}
+
+// readTestFile returns the content of the publication file.
+func readTestFile(t *testing.T, data []byte, name string) string {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := zr.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	content, err := io.ReadAll(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+func TestModified(t *testing.T) {
+	now := time.Date(2021, 3, 15, 10, 20, 30, 0, time.UTC)
+	set := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		name     string
+		opts     []epub.Option
+		metadata func(m *epub.Metadata)
+		modified string // expected value or error
+	}{
+		{"clock", nil, func(m *epub.Metadata) {}, "2021-03-15T10:20:30Z"},
+		{"SetModified", nil, func(m *epub.Metadata) { m.SetModified(set) }, "2020-01-02T03:04:05Z"},
+		{"meta", nil, func(m *epub.Metadata) {
+			m.Meta = append(m.Meta, epub.Meta{Property: "dcterms:modified", Value: "2020-01-02T03:04:05Z"})
+		}, "2021-03-15T10:20:30Z"},
+		{"PreserveModified", []epub.Option{epub.PreserveModified()}, func(m *epub.Metadata) {
+			m.Meta = append(m.Meta, epub.Meta{Property: "dcterms:modified", Value: "2020-01-02T03:04:05Z"})
+		}, "2020-01-02T03:04:05Z"},
+		{"PreserveModified without time", []epub.Option{epub.PreserveModified()},
+			func(m *epub.Metadata) {}, "2021-03-15T10:20:30Z"},
+		{"bad time", []epub.Option{epub.PreserveModified()}, func(m *epub.Metadata) {
+			m.Meta = append(m.Meta, epub.Meta{Property: "dcterms:modified", Value: "2020-01-02"})
+		}, `bad modified time "2020-01-02": must be in the form CCYY-MM-DDThh:mm:ssZ`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			opts := append([]epub.Option{epub.WithClock(func() time.Time { return now })}, test.opts...)
+			pub, err := epub.New(&buf, opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			test.metadata(&pub.Metadata)
+			if err := pub.Close(); err != nil {
+				if err.Error() != test.modified {
+					t.Errorf("error %q, want %q", err, test.modified)
+				}
+				return
+			}
+			pkg, err := epub.ReadPackage(strings.NewReader(readTestFile(t, buf.Bytes(), "OEBPS/package.opf")))
+			if err != nil {
+				t.Fatal(err)
+			}
+			modified, err := pkg.Metadata.Modified()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := modified.Format(epub.ModifiedLayout); got != test.modified {
+				t.Errorf("modified %s, want %s", got, test.modified)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package epub
+
+import (
+	"encoding/xml"
+)
+
+// Namespaces of content documents.
+const (
+	nsXHTML = "http://www.w3.org/1999/xhtml"
+	nsOPS   = "http://www.idpf.org/2007/ops"
+)
+
+// element is the XHTML element used to generate content documents.
+type element struct {
+	name     string
+	attrs    []xml.Attr
+	children []interface{} // *element or string
+}
+
+// newElement returns new XHTML element with attributes defined as name-value
+// pairs. Attributes with empty values are omitted.
+func newElement(name string, attrs ...string) *element {
+	e := &element{name: name}
+	for i := 0; i+1 < len(attrs); i += 2 {
+		if attrs[i+1] != "" {
+			e.attrs = append(e.attrs,
+				xml.Attr{Name: xml.Name{Local: attrs[i]}, Value: attrs[i+1]})
+		}
+	}
+	return e
+}
+
+// add appends child elements and text to the element and returns it.
+func (e *element) add(children ...interface{}) *element {
+	e.children = append(e.children, children...)
+	return e
+}
+
+// MarshalXML implements xml.Marshaler interface.
+func (e *element) MarshalXML(enc *xml.Encoder, start xml.StartElement) error {
+	start = xml.StartElement{Name: xml.Name{Local: e.name}, Attr: e.attrs}
+	if err := enc.EncodeToken(start); err != nil {
+		return err
+	}
+	for _, child := range e.children {
+		var err error
+		switch child := child.(type) {
+		case string:
+			err = enc.EncodeToken(xml.CharData(child))
+		case *element:
+			err = enc.EncodeElement(child, start)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return enc.EncodeToken(start.End())
+}
+
+// newDocument returns the root element of the XHTML content document with the
+// given title and language and the body element to fill.
+func newDocument(title, lang string) (html, body *element) {
+	body = newElement("body")
+	html = newElement("html",
+		"xmlns", nsXHTML,
+		"xmlns:epub", nsOPS,
+		"xml:lang", lang,
+		"lang", lang,
+	).add(
+		newElement("head").add(newElement("title").add(title)),
+		body,
+	)
+	return html, body
+}